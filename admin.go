@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type lobbySummary struct {
+	Id           string `json:"id"`
+	SenderCount  int    `json:"senderCount"`
+	MessageCount int    `json:"messageCount"`
+	CreatedAt    int64  `json:"createdAt"`
+}
+
+// isAdmin checks for "Authorization: Bearer <ADMIN_TOKEN>". With no ADMIN_TOKEN
+// configured nobody is an admin.
+func isAdmin(c *gin.Context) bool {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return false
+	}
+
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": ERR_ADMIN_REQUIRED, "message": "Admin token required!"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func getLobbySummaries(ctx context.Context) ([]lobbySummary, error) {
+	summaries := []lobbySummary{}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT lobbies.id,
+			(SELECT COUNT(*) FROM sender WHERE sender.lobbyId = lobbies.id),
+			(SELECT COUNT(*) FROM message WHERE message.lobbyId = lobbies.id),
+			lobbies.createdAt
+		FROM lobbies
+		ORDER BY lobbies.createdAt`)
+	if err != nil {
+		return nil, fmt.Errorf("list lobbies: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary lobbySummary
+		if err := rows.Scan(&summary.Id, &summary.SenderCount, &summary.MessageCount, &summary.CreatedAt); err != nil {
+			return nil, fmt.Errorf("list lobbies: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list lobbies: %w", err)
+	}
+
+	return summaries, nil
+}
+
+func adminListLobbies(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	summaries, err := store.GetLobbySummaries(ctx)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, summaries)
+}
+
+func adminKick(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var request sender
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return
+	}
+
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	removed, err := store.RemoveSender(ctx, request.LobbyId, request.Username)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_SENDER_NOT_FOUND, "message": "Sender is not in that lobby!"})
+		return
+	}
+
+	forgetTyping(senderKey{LobbyId: request.LobbyId, Name: request.Username})
+	disconnectSender(request.LobbyId, request.Username)
+
+	result, err := store.GetLobby(ctx, request.LobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusNotFound)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
+
+// adminClearLobby deletes every message in a lobby but keeps it and its
+// senders. lobbies don't record who created them, so this is admin only
+func adminClearLobby(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+
+	if exists, err := store.LobbyExists(ctx, id); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "lobby not found"})
+		return
+	}
+
+	respondClearedLobby(ctx, c, id)
+}
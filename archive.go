@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setLobbyArchived reports false if there's no such lobby. restoring records
+// when, so the reapers count the lobby as active from then on
+func setLobbyArchived(ctx context.Context, id string, archived bool) (bool, error) {
+	query := "UPDATE lobbies SET archived = TRUE, archivedAt = ? WHERE id = ?"
+	if !archived {
+		query = "UPDATE lobbies SET archived = FALSE, restoredAt = ? WHERE id = ?"
+	}
+
+	result, err := db.ExecContext(ctx, query, time.Now().Unix(), id)
+	if err != nil {
+		return false, fmt.Errorf("archive lobby %q: %w", id, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("archive lobby %q: %w", id, err)
+	}
+
+	return affected > 0, nil
+}
+
+func respondArchived(c *gin.Context, archived bool) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+
+	lobbyMutex.Lock()
+	defer lobbyMutex.Unlock()
+
+	found, err := store.SetLobbyArchived(ctx, id, archived)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "lobby not found"})
+		return
+	}
+
+	result, err := store.GetLobby(ctx, id)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
+
+func archiveLobby(c *gin.Context) {
+	respondArchived(c, true)
+}
+
+func restoreLobby(c *gin.Context) {
+	respondArchived(c, false)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+)
+
+const MAX_ATTACHMENTS_PER_MESSAGE = 4
+const MAX_ATTACHMENT_URL_LEN = 2048
+
+// an attachment is only a link, the server never hosts or fetches the file
+type attachment struct {
+	Url       string `json:"url"`
+	MimeType  string `json:"mimeType"`
+	SizeBytes *int64 `json:"sizeBytes"`
+}
+
+// validateAttachments checks the cap, that every url is absolute http(s) and
+// that every mime type parses. mime types are normalized in place
+func validateAttachments(attachments []attachment) error {
+	if len(attachments) > MAX_ATTACHMENTS_PER_MESSAGE {
+		return fmt.Errorf("a message can have at most %d attachments", MAX_ATTACHMENTS_PER_MESSAGE)
+	}
+
+	for i := range attachments {
+		a := &attachments[i]
+
+		if len(a.Url) > MAX_ATTACHMENT_URL_LEN {
+			return errors.New("attachment url is too long")
+		}
+
+		parsed, err := url.Parse(a.Url)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("attachment url must be an http(s) URL")
+		}
+
+		mediaType, _, err := mime.ParseMediaType(a.MimeType)
+		if err != nil {
+			return errors.New("attachment mimeType is invalid")
+		}
+		a.MimeType = mediaType
+
+		if a.SizeBytes != nil && *a.SizeBytes < 0 {
+			return errors.New("attachment sizeBytes can't be negative")
+		}
+	}
+
+	return nil
+}
+
+func insertAttachments(ctx context.Context, q querier, messageId int, attachments []attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(attachments)*4)
+	for _, a := range attachments {
+		args = append(args, messageId, a.Url, a.MimeType, a.SizeBytes)
+	}
+
+	_, err := q.ExecContext(ctx, "INSERT INTO attachments (messageId, url, mimeType, sizeBytes) VALUES "+placeholderRows(len(attachments), 4), args...)
+	if err != nil {
+		return fmt.Errorf("add attachments to %d: %w", messageId, err)
+	}
+	return nil
+}
+
+// loadAttachments fills in attachments for messages in a lobby, in the order
+// they were posted
+func loadAttachments(ctx context.Context, q querier, lobbyId string, messages []message) error {
+	byId := map[int]*message{}
+	for i := range messages {
+		messages[i].Attachments = []attachment{}
+		byId[messages[i].Id] = &messages[i]
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT attachments.messageId, attachments.url, attachments.mimeType, attachments.sizeBytes FROM attachments
+		JOIN message ON message.id = attachments.messageId
+		WHERE message.lobbyId = ?
+		ORDER BY attachments.id`, lobbyId)
+	if err != nil {
+		return fmt.Errorf("get attachments for %q: %w", lobbyId, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId int
+		var a attachment
+		if err := rows.Scan(&messageId, &a.Url, &a.MimeType, &a.SizeBytes); err != nil {
+			return fmt.Errorf("get attachments for %q: %w", lobbyId, err)
+		}
+
+		if msg, ok := byId[messageId]; ok {
+			msg.Attachments = append(msg.Attachments, a)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("get attachments for %q: %w", lobbyId, err)
+	}
+
+	return nil
+}
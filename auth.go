@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// where requireAuth leaves the username it took from the token
+const AUTH_USERNAME_KEY = "authUsername"
+
+const DEFAULT_JWT_USERNAME_CLAIM = "sub"
+
+// set up in main from AUTH_JWT_SECRET; nil means auth is off and usernames
+// are whatever the request body says
+var jwtSecret []byte
+var jwtUsernameClaim = DEFAULT_JWT_USERNAME_CLAIM
+
+func setupAuth() {
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		jwtSecret = []byte(secret)
+	}
+
+	if claim := os.Getenv("AUTH_JWT_USERNAME_CLAIM"); claim != "" {
+		jwtUsernameClaim = claim
+	}
+}
+
+// usernameFromToken checks an HS256 token's signature and expiry and returns
+// its username claim
+func usernameFromToken(raw string) (string, bool) {
+	token, err := jwt.Parse(raw, func(*jwt.Token) (any, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return "", false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", false
+	}
+
+	name, ok := claims[jwtUsernameClaim].(string)
+	name = strings.TrimSpace(name)
+	return name, ok && name != ""
+}
+
+// requireAuth guards write endpoints when AUTH_JWT_SECRET is set. the admin
+// token is let through too, for the endpoints admins can use
+func requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if jwtSecret == nil || isAdmin(c) {
+			c.Next()
+			return
+		}
+
+		raw, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": ERR_UNAUTHORIZED, "message": "Bearer token required!"})
+			return
+		}
+
+		name, ok := usernameFromToken(raw)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": ERR_UNAUTHORIZED, "message": "Token is invalid or expired!"})
+			return
+		}
+
+		c.Set(AUTH_USERNAME_KEY, name)
+		c.Next()
+	}
+}
+
+// authedName is the token's username when auth is on, otherwise the name the
+// client claimed in the request
+func authedName(c *gin.Context, claimed string) string {
+	if name, ok := c.Get(AUTH_USERNAME_KEY); ok {
+		return name.(string)
+	}
+	return claimed
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_BATCH_MESSAGES = 50
+
+// validateBatchItem applies postMessage's checks to one message of a batch
+// and returns the error body to respond with, or nil if it's fine. slash
+// commands respond on their own, so they can't be part of a batch
+func validateBatchItem(c *gin.Context, msg *message) gin.H {
+	msg.SenderName = authedName(c, msg.SenderName)
+	msg.Type = MESSAGE_TYPE_USER
+
+	if isReservedName(msg.SenderName) {
+		return gin.H{"code": ERR_USERNAME_RESERVED, "message": "That name is reserved!"}
+	}
+
+	if msg.ClientMessageId != nil && len(*msg.ClientMessageId) > MAX_CLIENT_MESSAGE_ID_LEN {
+		return gin.H{"code": ERR_CLIENT_MESSAGE_ID_TOO_LONG, "message": "clientMessageId is too long!", "maxLength": MAX_CLIENT_MESSAGE_ID_LEN}
+	}
+
+	if err := validateAttachments(msg.Attachments); err != nil {
+		return gin.H{"code": ERR_INVALID_ATTACHMENT, "message": err.Error()}
+	}
+
+	msg.MessageString = strings.TrimSpace(msg.MessageString)
+	if msg.MessageString == "" {
+		return gin.H{"code": ERR_MESSAGE_EMPTY, "message": "Message is empty!"}
+	}
+
+	if strings.HasPrefix(msg.MessageString, "//") {
+		msg.MessageString = msg.MessageString[1:]
+	} else if strings.HasPrefix(msg.MessageString, "/") {
+		return gin.H{"code": ERR_INVALID_COMMAND, "message": "Commands can't be sent in a batch!"}
+	}
+
+	if length := utf8.RuneCountInString(msg.MessageString); length > maxMsgLen {
+		return gin.H{"code": ERR_MESSAGE_TOO_LONG, "message": "Message is too long!", "maxLength": maxMsgLen, "actualLength": length}
+	}
+
+	filtered, allowed := filterMessage(msg.MessageString)
+	if !allowed {
+		return gin.H{"code": ERR_MESSAGE_BLOCKED, "message": "Message contains a blocked word!"}
+	}
+	msg.MessageString = filtered
+
+	return nil
+}
+
+// postMessages posts several messages to one lobby in order, for clients
+// catching up on what they wrote while offline. either all of them go in or,
+// if any fails validation, none do and the response says which one
+func postMessages(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var batch []message
+
+	if err := c.BindJSON(&batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Messages were invalid!"})
+		return
+	}
+
+	if len(batch) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_BATCH_EMPTY, "message": "No messages to post!"})
+		return
+	}
+
+	if len(batch) > MAX_BATCH_MESSAGES {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_BATCH_TOO_LARGE, "message": "Too many messages in one batch!", "max": MAX_BATCH_MESSAGES})
+		return
+	}
+
+	lobbyId := batch[0].LobbyId
+
+	for i := range batch {
+		if batch[i].LobbyId != lobbyId {
+			c.JSON(http.StatusBadRequest, gin.H{"code": ERR_BATCH_MIXED_LOBBIES, "message": "Every message in a batch must be for the same lobby!", "index": i})
+			return
+		}
+
+		if problem := validateBatchItem(c, &batch[i]); problem != nil {
+			problem["index"] = i
+			c.JSON(http.StatusBadRequest, problem)
+			return
+		}
+	}
+
+	settings, err := store.GetLobbySettings(ctx, lobbyId)
+	if errors.Is(err, errLobbyNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "Message did not belong to a lobby!"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if settings.Archived {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_LOBBY_ARCHIVED, "message": "This lobby is archived!"})
+		return
+	}
+
+	if settings.ReadOnly && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_LOBBY_READ_ONLY, "message": "This lobby is read-only!"})
+		return
+	}
+
+	// the session token only vouches for one sender, so a batch for a private
+	// lobby can't mix them
+	members := map[string]bool{}
+	for i, msg := range batch {
+		if members[msg.SenderName] {
+			continue
+		}
+
+		member, err := isLobbyMember(ctx, c, lobbyId, msg.SenderName)
+		if err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			return
+		} else if !member {
+			c.JSON(http.StatusForbidden, gin.H{"code": ERR_NOT_A_MEMBER, "message": "This lobby is private, enter it first!", "index": i})
+			return
+		}
+		members[msg.SenderName] = true
+	}
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	cacheKey := ""
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		cacheKey = idempotencyKey(lobbyId, batch[0].SenderName, key)
+
+		if original, ok := postIdempotency.get(cacheKey); ok {
+			c.Header("Idempotent-Replayed", "true")
+			respondLobby(c, http.StatusCreated, original)
+			return
+		}
+	}
+
+	// a batch counts as one post per sender for flooding, but slow mode means
+	// one message at a time, so a batch can only ever be a single message
+	checked := map[string]bool{}
+	for i, msg := range batch {
+		if checked[msg.SenderName] {
+			continue
+		}
+		checked[msg.SenderName] = true
+
+		if !senderFlood.allow(lobbyId, msg.SenderName) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": ERR_RATE_LIMITED, "message": "You're sending messages too fast!", "index": i})
+			return
+		}
+	}
+
+	if settings.SlowModeSeconds > 0 && !isAdmin(c) {
+		if len(batch) > 1 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": ERR_SLOW_MODE, "message": "Slow mode is on in this lobby, send one message at a time!", "index": 1})
+			return
+		}
+
+		wait, err := slowModeWait(ctx, lobbyId, batch[0].SenderName, settings.SlowModeSeconds)
+		if err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			return
+		}
+
+		if wait > 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": ERR_SLOW_MODE, "message": "Slow mode is on in this lobby!", "retryAfterSeconds": wait, "index": 0})
+			return
+		}
+	}
+
+	for i, msg := range batch {
+		if msg.ReplyToId == nil {
+			continue
+		}
+
+		parent, err := store.GetMessage(ctx, *msg.ReplyToId)
+		if errors.Is(err, errMessageNotFound) || (err == nil && parent.LobbyId != lobbyId) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": ERR_MESSAGE_NOT_IN_LOBBY, "message": "Replied-to message is not in this lobby!", "index": i})
+			return
+		} else if err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	inserted, lobbyData, err := store.AddMessages(ctx, lobbyId, batch)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	messagesInserted.Add(float64(len(inserted)))
+
+	if cacheKey != "" {
+		postIdempotency.put(cacheKey, lobbyData)
+	}
+
+	for _, msg := range inserted {
+		notifyWebhook(msg)
+
+		msg.MessageString = html.EscapeString(msg.MessageString)
+		broadcast(lobbyId, msg)
+	}
+
+	respondLobby(c, http.StatusCreated, lobbyData)
+}
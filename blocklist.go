@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+)
+
+const BLOCKLIST_MODE_REJECT = "reject"
+const BLOCKLIST_MODE_MASK = "mask"
+
+var blocklistMutex sync.RWMutex
+
+// nil when there's no blocklist configured
+var blocklistPattern *regexp.Regexp
+var blocklistMode = BLOCKLIST_MODE_REJECT
+
+// loadBlocklist reads one blocked word per line; blank lines and # comments are skipped
+func loadBlocklist(path string) (*regexp.Regexp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("load blocklist: %w", err)
+	}
+	defer file.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, regexp.QuoteMeta(word))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load blocklist: %w", err)
+	}
+
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	// word boundaries are checked in blockedWords, since \b only knows ASCII
+	return regexp.Compile(`(?i)(?:` + strings.Join(words, "|") + `)`)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == '_'
+}
+
+// blockedWords finds the [start, end) of each match of pattern that stands
+// as a whole word, so "café" is caught but not "cafés"
+func blockedWords(pattern *regexp.Regexp, content string) [][]int {
+	matches := [][]int{}
+
+	for start := 0; start < len(content); {
+		loc := pattern.FindStringIndex(content[start:])
+		if loc == nil {
+			break
+		}
+		from, to := start+loc[0], start+loc[1]
+
+		before, _ := utf8.DecodeLastRuneInString(content[:from])
+		after, _ := utf8.DecodeRuneInString(content[to:])
+		if (from == 0 || !isWordRune(before)) && (to == len(content) || !isWordRune(after)) {
+			matches = append(matches, []int{from, to})
+			start = to
+			continue
+		}
+
+		// not a whole word, but a shorter or later one could still start here
+		_, size := utf8.DecodeRuneInString(content[from:])
+		start = from + size
+	}
+
+	return matches
+}
+
+// setupBlocklist loads BLOCKLIST_FILE, if set, and reloads it on SIGHUP
+func setupBlocklist() error {
+	path := os.Getenv("BLOCKLIST_FILE")
+	if path == "" {
+		return nil
+	}
+
+	mode := os.Getenv("BLOCKLIST_MODE")
+	if mode == "" {
+		mode = BLOCKLIST_MODE_REJECT
+	}
+	if mode != BLOCKLIST_MODE_REJECT && mode != BLOCKLIST_MODE_MASK {
+		return fmt.Errorf("BLOCKLIST_MODE must be %q or %q, got %q", BLOCKLIST_MODE_REJECT, BLOCKLIST_MODE_MASK, mode)
+	}
+
+	pattern, err := loadBlocklist(path)
+	if err != nil {
+		return err
+	}
+
+	blocklistMutex.Lock()
+	blocklistPattern = pattern
+	blocklistMode = mode
+	blocklistMutex.Unlock()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			pattern, err := loadBlocklist(path)
+			if err != nil {
+				// keep filtering with the old list rather than none at all
+				slog.Error("reloading blocklist", "error", err)
+				continue
+			}
+
+			blocklistMutex.Lock()
+			blocklistPattern = pattern
+			blocklistMutex.Unlock()
+
+			slog.Info("reloaded blocklist", "path", path)
+		}
+	}()
+
+	return nil
+}
+
+// filterMessage applies the blocklist to content. In reject mode it reports
+// false when a blocked word shows up; in mask mode the words get starred out.
+func filterMessage(content string) (string, bool) {
+	blocklistMutex.RLock()
+	pattern, mode := blocklistPattern, blocklistMode
+	blocklistMutex.RUnlock()
+
+	if pattern == nil {
+		return content, true
+	}
+
+	matches := blockedWords(pattern, content)
+	if len(matches) == 0 {
+		return content, true
+	}
+
+	if mode == BLOCKLIST_MODE_REJECT {
+		return content, false
+	}
+
+	var masked strings.Builder
+	last := 0
+	for _, match := range matches {
+		masked.WriteString(content[last:match[0]])
+		masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(content[match[0]:match[1]])))
+		last = match[1]
+	}
+	masked.WriteString(content[last:])
+
+	return masked.String(), true
+}
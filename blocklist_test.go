@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useBlocklist loads words as the active blocklist for the rest of the test
+func useBlocklist(t *testing.T, mode string, words string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(words), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern, err := loadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocklistMutex.Lock()
+	oldPattern, oldMode := blocklistPattern, blocklistMode
+	blocklistPattern, blocklistMode = pattern, mode
+	blocklistMutex.Unlock()
+
+	t.Cleanup(func() {
+		blocklistMutex.Lock()
+		blocklistPattern, blocklistMode = oldPattern, oldMode
+		blocklistMutex.Unlock()
+	})
+}
+
+func TestFilterMessageReject(t *testing.T) {
+	useBlocklist(t, BLOCKLIST_MODE_REJECT, "# comment\nheck\n\ncafé\n")
+
+	tests := []struct {
+		content string
+		allowed bool
+	}{
+		{"what the heck", false},
+		{"HECK!", false},
+		{"heckler", true},
+		{"check this", true},
+		{"café", false},
+		{"a café, please", false},
+		{"cafés", true},
+		{"Caféx", true},
+		{"_heck", true},
+		{"nothing to see", true},
+	}
+
+	for _, test := range tests {
+		filtered, allowed := filterMessage(test.content)
+		if allowed != test.allowed {
+			t.Errorf("filterMessage(%q) allowed = %v, want %v", test.content, allowed, test.allowed)
+		}
+		if filtered != test.content {
+			t.Errorf("filterMessage(%q) changed the content to %q in reject mode", test.content, filtered)
+		}
+	}
+}
+
+func TestFilterMessageMask(t *testing.T) {
+	useBlocklist(t, BLOCKLIST_MODE_MASK, "heck\ncafé\n")
+
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"what the heck", "what the ****"},
+		{"heck heck", "**** ****"},
+		{"Heck, a café", "****, a ****"},
+		{"cafés and heckler", "cafés and heckler"},
+		{"über café", "über ****"},
+	}
+
+	for _, test := range tests {
+		filtered, allowed := filterMessage(test.content)
+		if !allowed {
+			t.Errorf("filterMessage(%q) rejected in mask mode", test.content)
+		}
+		if filtered != test.want {
+			t.Errorf("filterMessage(%q) = %q, want %q", test.content, filtered, test.want)
+		}
+	}
+}
+
+func TestFilterMessageNoBlocklist(t *testing.T) {
+	useBlocklist(t, BLOCKLIST_MODE_REJECT, "# only comments\n")
+
+	if filtered, allowed := filterMessage("heck"); !allowed || filtered != "heck" {
+		t.Errorf("filterMessage with an empty blocklist = %q, %v", filtered, allowed)
+	}
+}
+
+func TestImportAppliesBlocklist(t *testing.T) {
+	messages := []importedMessage{
+		{SenderName: "alice", MessageString: "what the heck"},
+		{SenderName: "alice", MessageString: "fine"},
+	}
+
+	useBlocklist(t, BLOCKLIST_MODE_REJECT, "heck\n")
+	valid, skipped := validateImport(messages)
+	if len(valid) != 1 || valid[0].MessageString != "fine" {
+		t.Errorf("reject mode kept %+v, want only the clean message", valid)
+	}
+	if len(skipped) != 1 || skipped[0].Index != 0 {
+		t.Errorf("reject mode skipped %+v, want the first message", skipped)
+	}
+
+	useBlocklist(t, BLOCKLIST_MODE_MASK, "heck\n")
+	valid, skipped = validateImport(messages)
+	if len(valid) != 2 || len(skipped) != 0 {
+		t.Fatalf("mask mode kept %d and skipped %d, want both kept", len(valid), len(skipped))
+	}
+	if valid[0].MessageString != "what the ****" {
+		t.Errorf("mask mode imported %q, want it masked", valid[0].MessageString)
+	}
+}
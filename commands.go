@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const SHRUG = `¯\_(ツ)_/¯`
+
+// a slashCommand either rewrites msg and returns false so postMessage carries
+// on, or does something else entirely, responds itself and returns true
+type slashCommand func(ctx context.Context, c *gin.Context, msg *message, args string) bool
+
+var slashCommands = map[string]slashCommand{
+	"me":    meCommand,
+	"shrug": shrugCommand,
+	"clear": clearCommand,
+}
+
+func commandNames() []string {
+	names := []string{}
+	for name := range slashCommands {
+		names = append(names, "/"+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runSlashCommand handles messages starting with "/". "//" sends a literal
+// slash, for messages like file paths
+func runSlashCommand(ctx context.Context, c *gin.Context, msg *message) bool {
+	if !strings.HasPrefix(msg.MessageString, "/") {
+		return false
+	}
+
+	if strings.HasPrefix(msg.MessageString, "//") {
+		msg.MessageString = msg.MessageString[1:]
+		return false
+	}
+
+	name, args, _ := strings.Cut(msg.MessageString[1:], " ")
+	command, ok := slashCommands[strings.ToLower(name)]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_UNKNOWN_COMMAND, "message": fmt.Sprintf("Unknown command /%s!", name), "commands": commandNames()})
+		return true
+	}
+
+	return command(ctx, c, msg, strings.TrimSpace(args))
+}
+
+// "/me waves" -> "* alice waves"
+func meCommand(ctx context.Context, c *gin.Context, msg *message, args string) bool {
+	if args == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_COMMAND, "message": "Usage: /me <action>"})
+		return true
+	}
+
+	msg.MessageString = "* " + msg.SenderName + " " + args
+	return false
+}
+
+func shrugCommand(ctx context.Context, c *gin.Context, msg *message, args string) bool {
+	msg.MessageString = strings.TrimSpace(args + " " + SHRUG)
+	return false
+}
+
+// "/clear" wipes the lobby's messages, admins only
+func clearCommand(ctx context.Context, c *gin.Context, msg *message, args string) bool {
+	if !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_ADMIN_REQUIRED, "message": "Only admins can /clear!"})
+		return true
+	}
+
+	if exists, err := store.LobbyExists(ctx, msg.LobbyId); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return true
+	} else if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "Message did not belong to a lobby!"})
+		return true
+	}
+
+	respondClearedLobby(ctx, c, msg.LobbyId)
+	return true
+}
+
+// respondClearedLobby clears the lobby's messages, tells subscribers, and
+// responds with what's left
+func respondClearedLobby(ctx context.Context, c *gin.Context, lobbyId string) {
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	if err := store.ClearLobby(ctx, lobbyId); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	result, err := store.GetLobby(ctx, lobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	broadcast(lobbyId, gin.H{"type": "cleared"})
+	respondLobby(c, http.StatusOK, result)
+}
+
+// clearLobbyMessages deletes every message in the lobby and their reactions
+// and attachments. callers should hold msgMutex
+func clearLobbyMessages(ctx context.Context, lobbyId string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("clear %q: %w", lobbyId, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deleteMessagesWhere(ctx, tx, "message.lobbyId = ?", lobbyId); err != nil {
+		return fmt.Errorf("clear %q: %w", lobbyId, err)
+	}
+
+	// read positions would otherwise point past every future message
+	if _, err := tx.ExecContext(ctx, "UPDATE sender SET lastReadMessageId = NULL WHERE lobbyId = ?", lobbyId); err != nil {
+		return fmt.Errorf("clear %q: %w", lobbyId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("clear %q: %w", lobbyId, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// bumped if the layout ever changes, so old cursors fail cleanly
+const CURSOR_VERSION = 1
+
+// version byte + position + truncated HMAC
+const CURSOR_POSITION_LEN = 8
+const CURSOR_MAC_LEN = 8
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// signs cursors. without CURSOR_SECRET it's random per process, so cursors
+// stop working across restarts and between replicas
+var cursorKey []byte
+
+func setupCursors() {
+	if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+		cursorKey = []byte(secret)
+		return
+	}
+
+	cursorKey = make([]byte, 32)
+	if _, err := rand.Read(cursorKey); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %v", err))
+	}
+}
+
+func cursorMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)[:CURSOR_MAC_LEN]
+}
+
+// encodeCursor wraps a paging position (a message id, for now) so clients
+// can't read or forge it
+func encodeCursor(position int) string {
+	payload := make([]byte, 1+CURSOR_POSITION_LEN, 1+CURSOR_POSITION_LEN+CURSOR_MAC_LEN)
+	payload[0] = CURSOR_VERSION
+	binary.BigEndian.PutUint64(payload[1:], uint64(position))
+
+	return base64.RawURLEncoding.EncodeToString(append(payload, cursorMAC(payload)...))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) != 1+CURSOR_POSITION_LEN+CURSOR_MAC_LEN || raw[0] != CURSOR_VERSION {
+		return 0, errInvalidCursor
+	}
+
+	payload, mac := raw[:1+CURSOR_POSITION_LEN], raw[1+CURSOR_POSITION_LEN:]
+	if !hmac.Equal(mac, cursorMAC(payload)) {
+		return 0, errInvalidCursor
+	}
+
+	position := binary.BigEndian.Uint64(payload[1:])
+	if position == 0 || position > uint64(^uint32(0)>>1) {
+		return 0, errInvalidCursor
+	}
+
+	return int(position), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, position := range []int{1, 42, 1 << 20, int(^uint32(0) >> 1)} {
+		cursor := encodeCursor(position)
+
+		if got, err := decodeCursor(cursor); err != nil || got != position {
+			t.Errorf("position %d came back as %d, %v", position, got, err)
+		}
+
+		// the id shouldn't be readable straight off the cursor
+		if cursor == strconv.Itoa(position) {
+			t.Errorf("cursor for %d is the raw id", position)
+		}
+	}
+}
+
+func TestCursorRejectsTampering(t *testing.T) {
+	raw, err := base64.RawURLEncoding.DecodeString(encodeCursor(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a different position with the original checksum
+	moved := slices.Clone(raw)
+	binary.BigEndian.PutUint64(moved[1:], 43)
+
+	flipped := slices.Clone(raw)
+	flipped[len(flipped)-1] ^= 1
+
+	versioned := slices.Clone(raw)
+	versioned[0] = CURSOR_VERSION + 1
+
+	for name, cursor := range map[string]string{
+		"moved position":   base64.RawURLEncoding.EncodeToString(moved),
+		"flipped checksum": base64.RawURLEncoding.EncodeToString(flipped),
+		"unknown version":  base64.RawURLEncoding.EncodeToString(versioned),
+		"truncated":        base64.RawURLEncoding.EncodeToString(raw[:len(raw)-1]),
+		"not base64":       "!!!",
+		"a raw id":         "42",
+		"empty":            "",
+	} {
+		if position, err := decodeCursor(cursor); err == nil {
+			t.Errorf("%s: decoded to %d, want an error", name, position)
+		}
+	}
+}
+
+func TestLobbyPagesFollowCursors(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	for i := range 5 {
+		if _, _, err := mem.AddMessage(context.Background(), message{LobbyId: id, SenderName: "alice", MessageString: "message " + strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := doRequest(t, router, http.MethodGet, "/lobby/"+id+"?cursor=tampered", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	// newest page first, each one older than the last
+	pages := [][]string{}
+	path := "/lobby/" + id + "?limit=2"
+	for {
+		w := doRequest(t, router, http.MethodGet, path, nil)
+		expectStatus(t, w, http.StatusOK)
+
+		page := decodeBody[lobbyData](t, w)
+		pages = append(pages, messageContents(page.Messages))
+		if !page.HasMore {
+			break
+		}
+
+		if page.NextCursor == nil {
+			t.Fatal("hasMore without a nextCursor")
+		}
+		path = "/lobby/" + id + "?limit=2&cursor=" + *page.NextCursor
+	}
+
+	seen := []string{}
+	for i := len(pages) - 1; i >= 0; i-- {
+		seen = append(seen, pages[i]...)
+	}
+
+	want := []string{"message 0", "message 1", "message 2", "message 3", "message 4"}
+	if !slices.Equal(seen, want) {
+		t.Errorf("paged through %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// stored messages that start with this are ciphertext. anything else is a
+// plaintext row from before encryption was turned on
+const ENCRYPTED_PREFIX = "enc1:"
+
+// shown instead of a message we can't decrypt, e.g. after the key was rotated
+const UNREADABLE_PLACEHOLDER = "[message could not be decrypted]"
+
+// set up in main from ENCRYPTION_KEY; nil means messages are stored as plaintext
+var messageCipher cipher.AEAD
+
+// setupEncryption takes ENCRYPTION_KEY as a base64 encoded 16, 24 or 32 byte
+// AES key. a bad key stops startup rather than silently storing plaintext
+func setupEncryption() {
+	encoded := os.Getenv("ENCRYPTION_KEY")
+	if encoded == "" {
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.Fatal("ENCRYPTION_KEY must be base64: ", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatal("ENCRYPTION_KEY must decode to 16, 24 or 32 bytes: ", err)
+	}
+
+	messageCipher, err = cipher.NewGCM(block)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func encryptMessage(plaintext string) (string, error) {
+	if messageCipher == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, messageCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("encrypt message: %w", err)
+	}
+
+	sealed := messageCipher.Seal(nonce, nonce, []byte(plaintext), nil)
+	return ENCRYPTED_PREFIX + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptMessage never fails, so one bad row can't break a whole lobby fetch
+func decryptMessage(stored string) string {
+	encoded, found := strings.CutPrefix(stored, ENCRYPTED_PREFIX)
+	if !found {
+		return stored
+	}
+
+	if messageCipher == nil {
+		return UNREADABLE_PLACEHOLDER
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < messageCipher.NonceSize() {
+		return UNREADABLE_PLACEHOLDER
+	}
+
+	nonce, ciphertext := sealed[:messageCipher.NonceSize()], sealed[messageCipher.NonceSize():]
+	plaintext, err := messageCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return UNREADABLE_PLACEHOLDER
+	}
+
+	return string(plaintext)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clients opt in to enveloped responses with this header, so existing ones
+// keep getting the bare shapes
+const ENVELOPE_HEADER = "X-Response-Envelope"
+
+// routes that stream can't be buffered up and rewrapped
+var unenvelopedRoutes = []string{"/ws/:id", "/events/:id", "/lobby/:id/export", "/lobby/:id/stream", "/metrics"}
+
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error *string         `json:"error"`
+	Code  string          `json:"code,omitempty"`
+}
+
+func wantsEnvelope(c *gin.Context) bool {
+	return c.GetHeader(ENVELOPE_HEADER) == "true"
+}
+
+// envelopeWriter holds on to the handler's response so it can be rewrapped
+type envelopeWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *envelopeWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *envelopeWriter) WriteHeaderNow() {}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *envelopeWriter) Status() int {
+	return w.status
+}
+
+func (w *envelopeWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *envelopeWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// responseEnvelope wraps JSON responses as {"data": ..., "error": null}, or
+// {"data": null, "error": "...", "code": "..."} for failures, when the client
+// asks for it
+func responseEnvelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !wantsEnvelope(c) || slices.Contains(unenvelopedRoutes, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		w := &envelopeWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = w
+
+		c.Next()
+
+		c.Writer = original
+
+		// 204s, 304s and anything that isn't JSON go out as they are
+		if w.body.Len() == 0 || !strings.HasPrefix(original.Header().Get("Content-Type"), "application/json") {
+			original.WriteHeader(w.status)
+			original.Write(w.body.Bytes())
+			return
+		}
+
+		wrapped := envelope{Data: json.RawMessage(w.body.Bytes())}
+		if w.status >= http.StatusBadRequest {
+			var failure struct {
+				Message string `json:"message"`
+				Code    string `json:"code"`
+			}
+			json.Unmarshal(w.body.Bytes(), &failure)
+			if failure.Message == "" {
+				failure.Message = http.StatusText(w.status)
+			}
+
+			wrapped = envelope{Data: json.RawMessage("null"), Error: &failure.Message, Code: failure.Code}
+		}
+
+		encoded, err := json.Marshal(wrapped)
+		if err != nil {
+			original.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		original.WriteHeader(w.status)
+		original.Write(encoded)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+// codes sent as "code" alongside "message" in every error response. the
+// message is for people and may be reworded, these stay the same so clients
+// can branch on them
+const (
+	ERR_INVALID_REQUEST        = "INVALID_REQUEST"
+	ERR_UNSUPPORTED_MEDIA_TYPE = "UNSUPPORTED_MEDIA_TYPE"
+	ERR_BODY_TOO_LARGE         = "BODY_TOO_LARGE"
+	ERR_INVALID_PARAMETER      = "INVALID_PARAMETER"
+	ERR_RATE_LIMITED           = "RATE_LIMITED"
+	ERR_INTERNAL               = "INTERNAL_ERROR"
+	ERR_DATABASE               = "DATABASE_ERROR"
+	ERR_TIMEOUT                = "TIMEOUT"
+
+	ERR_UNAUTHORIZED    = "UNAUTHORIZED"
+	ERR_ADMIN_REQUIRED  = "ADMIN_REQUIRED"
+	ERR_NOT_AUTHOR      = "NOT_AUTHOR"
+	ERR_INVALID_SESSION = "INVALID_SESSION"
+	ERR_NOT_A_MEMBER    = "NOT_A_MEMBER"
+
+	ERR_LOBBY_NOT_FOUND        = "LOBBY_NOT_FOUND"
+	ERR_LOBBY_ID_INVALID       = "LOBBY_ID_INVALID"
+	ERR_LOBBY_ID_TAKEN         = "LOBBY_ID_TAKEN"
+	ERR_LOBBY_NAME_TOO_LONG    = "LOBBY_NAME_TOO_LONG"
+	ERR_PASSWORD_TOO_LONG      = "PASSWORD_TOO_LONG"
+	ERR_WRONG_PASSWORD         = "WRONG_PASSWORD"
+	ERR_LOBBY_FULL             = "LOBBY_FULL"
+	ERR_LOBBY_ARCHIVED         = "LOBBY_ARCHIVED"
+	ERR_LOBBY_READ_ONLY        = "LOBBY_READ_ONLY"
+	ERR_LOBBY_CAPACITY_REACHED = "LOBBY_CAPACITY_REACHED" // MAX_TOTAL_LOBBIES
+	ERR_TOO_MANY_LOBBIES       = "TOO_MANY_LOBBIES"       // MAX_LOBBIES_PER_IP
+	ERR_SLOW_MODE              = "SLOW_MODE"
+	ERR_TOO_MANY_PINS          = "TOO_MANY_PINS"
+	ERR_SENDER_NOT_FOUND       = "SENDER_NOT_FOUND"
+	ERR_USERNAME_EMPTY         = "USERNAME_EMPTY"
+	ERR_USERNAME_TOO_LONG      = "USERNAME_TOO_LONG"
+	ERR_USERNAME_TAKEN         = "USERNAME_TAKEN"
+	ERR_USERNAME_RESERVED      = "USERNAME_RESERVED"
+	ERR_INVALID_PROFILE        = "INVALID_PROFILE"
+
+	ERR_MESSAGE_NOT_FOUND          = "MESSAGE_NOT_FOUND"
+	ERR_MESSAGE_NOT_IN_LOBBY       = "MESSAGE_NOT_IN_LOBBY"
+	ERR_MESSAGE_EMPTY              = "MESSAGE_EMPTY"
+	ERR_MESSAGE_TOO_LONG           = "MESSAGE_TOO_LONG"
+	ERR_MESSAGE_BLOCKED            = "MESSAGE_BLOCKED"
+	ERR_VERSION_CONFLICT           = "VERSION_CONFLICT"
+	ERR_EDIT_WINDOW_PASSED         = "EDIT_WINDOW_PASSED"
+	ERR_CLIENT_MESSAGE_ID_TOO_LONG = "CLIENT_MESSAGE_ID_TOO_LONG"
+	ERR_INVALID_ATTACHMENT         = "INVALID_ATTACHMENT"
+	ERR_UNKNOWN_COMMAND            = "UNKNOWN_COMMAND"
+	ERR_INVALID_COMMAND            = "INVALID_COMMAND"
+	ERR_BATCH_EMPTY                = "BATCH_EMPTY"
+	ERR_BATCH_TOO_LARGE            = "BATCH_TOO_LARGE"
+	ERR_BATCH_MIXED_LOBBIES        = "BATCH_MIXED_LOBBIES"
+	ERR_IMPORT_TOO_LARGE           = "IMPORT_TOO_LARGE"
+	ERR_INVALID_EMOJI              = "INVALID_EMOJI"
+	ERR_ALREADY_REACTED            = "ALREADY_REACTED"
+	ERR_REACTION_NOT_FOUND         = "REACTION_NOT_FOUND"
+)
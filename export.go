@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flush to the client every this many rows so big exports start downloading
+// right away
+const EXPORT_FLUSH_EVERY = 500
+
+var CSV_EXPORT_HEADER = []string{"id", "sender", "content", "timestamp"}
+
+// exportLobby streams a lobby's whole history as a JSON array or CSV download
+func exportLobby(c *gin.Context) {
+	id := c.Param("id")
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_PARAMETER, "message": "format must be json or csv!"})
+		return
+	}
+
+	checkCtx, cancel := dbContext(c)
+	exists, err := store.LobbyExists(checkCtx, id)
+	cancel()
+
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "lobby not found"})
+		return
+	}
+
+	// no query timeout here, a big lobby can legitimately take a while to send.
+	// the request context still cancels it if the client goes away
+	ctx := c.Request.Context()
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="lobby-%s.%s"`, id, format))
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		err = writeCSVExport(ctx, c, id, showDeleted(c))
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		err = writeJSONExport(ctx, c, id, showDeleted(c))
+	}
+
+	if err != nil {
+		failExport(c, id, err)
+	}
+}
+
+// failExport reports an export that went wrong. if nothing was sent yet it's
+// a normal error response, otherwise the status is already out and all we
+// can do is log and cut the download short
+func failExport(c *gin.Context, id string, err error) {
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		respondDBError(c, fmt.Errorf("export %q: %w", id, err), http.StatusInternalServerError)
+		return
+	}
+
+	loggerFrom(c.Request.Context()).Error("export failed", "lobbyId", id, "error", err)
+}
+
+// csvCell stops spreadsheet apps from running user text as a formula, by
+// prefixing anything that starts like one with a quote
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func writeCSVExport(ctx context.Context, c *gin.Context, lobbyId string, includeDeleted bool) error {
+	w := csv.NewWriter(c.Writer)
+	count := 0
+
+	err := store.EachMessage(ctx, lobbyId, func(msg message) error {
+		if count == 0 {
+			if err := w.Write(CSV_EXPORT_HEADER); err != nil {
+				return err
+			}
+		}
+		count++
+
+		if !includeDeleted {
+			msg.redact()
+		}
+
+		record := []string{
+			strconv.Itoa(msg.Id),
+			csvCell(msg.SenderName),
+			csvCell(msg.MessageString),
+			time.Unix(msg.Timestamp, 0).UTC().Format(time.RFC3339),
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+
+		if count%EXPORT_FLUSH_EVERY == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// an empty lobby still gets its header row
+	if count == 0 {
+		if err := w.Write(CSV_EXPORT_HEADER); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// writeJSONExport writes the array by hand so only one message is in memory
+// at a time
+func writeJSONExport(ctx context.Context, c *gin.Context, lobbyId string, includeDeleted bool) error {
+	count := 0
+
+	err := store.EachMessage(ctx, lobbyId, func(msg message) error {
+		if !includeDeleted {
+			msg.redact()
+		}
+
+		encoded, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		separator := ","
+		if count == 0 {
+			separator = "["
+		}
+		if _, err := c.Writer.WriteString(separator); err != nil {
+			return err
+		}
+		if _, err := c.Writer.Write(encoded); err != nil {
+			return err
+		}
+
+		count++
+		if count%EXPORT_FLUSH_EVERY == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	closing := "]"
+	if count == 0 {
+		closing = "[]"
+	}
+
+	_, err = c.Writer.WriteString(closing)
+	return err
+}
+
+// streamHeader is the first line of GET /lobby/:id/stream
+type streamHeader struct {
+	Type      string   `json:"type"`
+	Id        string   `json:"id"`
+	Name      *string  `json:"name"`
+	CreatedAt int64    `json:"createdAt"`
+	Senders   []sender `json:"senders"`
+}
+
+// streamLobby sends the lobby as newline-delimited JSON: a "lobby" header
+// line with the senders, then one line per message straight off the cursor.
+// messages don't carry reactions here, that would mean holding them all
+func streamLobby(c *gin.Context) {
+	id := c.Param("id")
+
+	headerCtx, cancel := dbContext(c)
+	lobby, err := store.GetLobbyInfo(headerCtx, id)
+	if err == nil {
+		lobby.Senders, err = store.GetSenders(headerCtx, id)
+	}
+	cancel()
+
+	if errors.Is(err, errLobbyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "lobby not found"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	// same as exportLobby, no query timeout for the long part
+	ctx := c.Request.Context()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	if err := writeNDJSON(ctx, c, streamHeader{Type: "lobby", Id: lobby.Id, Name: lobby.Name, CreatedAt: lobby.CreatedAt, Senders: lobby.Senders}); err != nil {
+		loggerFrom(ctx).Error("stream failed", "lobbyId", id, "error", err)
+	}
+}
+
+func writeNDJSON(ctx context.Context, c *gin.Context, header streamHeader) error {
+	// Encode adds the newline after each value
+	encoder := json.NewEncoder(c.Writer)
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+
+	count := 0
+	err := store.EachMessage(ctx, header.Id, func(msg message) error {
+		prepareMessage(c, &msg)
+
+		if err := encoder.Encode(msg); err != nil {
+			return err
+		}
+
+		count++
+		if count%EXPORT_FLUSH_EVERY == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Writer.Flush()
+	return nil
+}
+
+// eachMessage reads the lobby's messages straight off the cursor
+func eachMessage(ctx context.Context, lobbyId string, fn func(message) error) error {
+	rows, err := db.QueryContext(ctx, "SELECT "+MESSAGE_COLUMNS+" FROM message WHERE lobbyId = ? ORDER BY id ASC", lobbyId)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg message
+		if err := scanMessage(rows, &msg); err != nil {
+			return err
+		}
+
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
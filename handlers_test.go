@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain does the setup main would, minus the database
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	setupAuth()
+	setupReservedNames()
+	setupCursors()
+	if err := setupLimits(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// useMemStore points the handlers at a fresh memStore for the test
+func useMemStore(t *testing.T) *memStore {
+	t.Helper()
+
+	mem := newMemStore()
+	previous := store
+	store = mem
+	t.Cleanup(func() { store = previous })
+	return mem
+}
+
+func newRequest(t *testing.T, method string, path string, body any) *http.Request {
+	t.Helper()
+
+	if body == nil {
+		return httptest.NewRequest(method, path, nil)
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func serve(router http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func doRequest(t *testing.T, router http.Handler, method string, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return serve(router, newRequest(t, method, path, body))
+}
+
+func decodeBody[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if w.Code != want {
+		t.Fatalf("got status %d, want %d: %s", w.Code, want, w.Body.String())
+	}
+}
+
+// createTestLobby creates a lobby and returns its id
+func createTestLobby(t *testing.T, router http.Handler, request createLobbyRequest) string {
+	t.Helper()
+
+	w := doRequest(t, router, http.MethodPost, "/createLobby", request)
+	expectStatus(t, w, http.StatusCreated)
+	return decodeBody[string](t, w)
+}
+
+// enterTestLobby joins as name and returns the session token
+func enterTestLobby(t *testing.T, router http.Handler, lobbyId string, name string) string {
+	t.Helper()
+
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": lobbyId, "name": name})
+	expectStatus(t, w, http.StatusOK)
+	return decodeBody[enterLobbyResponse](t, w).SessionToken
+}
+
+func postTestMessage(t *testing.T, router http.Handler, lobbyId string, name string, content string) lobbyData {
+	t.Helper()
+
+	w := doRequest(t, router, http.MethodPost, "/postMessage", gin.H{"lobbyId": lobbyId, "senderName": name, "messageContent": content})
+	expectStatus(t, w, http.StatusCreated)
+	return decodeBody[lobbyData](t, w)
+}
+
+// lastUserMessage skips the join and leave notices
+func lastUserMessage(t *testing.T, lobby lobbyData) message {
+	t.Helper()
+
+	for i := len(lobby.Messages) - 1; i >= 0; i-- {
+		if lobby.Messages[i].Type == MESSAGE_TYPE_USER {
+			return lobby.Messages[i]
+		}
+	}
+
+	t.Fatal("lobby has no user messages")
+	return message{}
+}
+
+func TestEnterLobbyAddsSender(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": "alice"})
+	expectStatus(t, w, http.StatusOK)
+
+	entered := decodeBody[enterLobbyResponse](t, w)
+	if entered.SessionToken == "" {
+		t.Error("no session token")
+	}
+	if len(entered.Senders) != 1 || entered.Senders[0].Username != "alice" {
+		t.Errorf("got senders %+v, want just alice", entered.Senders)
+	}
+
+	w = doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": "alice"})
+	expectStatus(t, w, http.StatusConflict)
+}
+
+func TestEnterMissingLobby(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": "nope", "name": "alice"})
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestEnterLobbyChecksPassword(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{Password: "hunter2"})
+
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": "alice", "password": "wrong"})
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	w = doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": "alice", "password": "hunter2"})
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestPostMessageShowsUpInLobby(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	postTestMessage(t, router, id, "alice", "hello there")
+
+	w := doRequest(t, router, http.MethodGet, "/lobby/"+id, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	msg := lastUserMessage(t, decodeBody[lobbyData](t, w))
+	if msg.SenderName != "alice" || msg.MessageString != "hello there" {
+		t.Errorf("got %q from %q, want \"hello there\" from alice", msg.MessageString, msg.SenderName)
+	}
+}
+
+func TestFetchMissingLobby(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	w := doRequest(t, router, http.MethodGet, "/lobby/nope", nil)
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestEditMessageOnlyByAuthor(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	enterTestLobby(t, router, id, "bob")
+	msg := lastUserMessage(t, postTestMessage(t, router, id, "alice", "first"))
+	path := "/message/" + strconv.Itoa(msg.Id)
+
+	w := doRequest(t, router, http.MethodPut, path, gin.H{"senderName": "bob", "messageContent": "hijacked", "version": msg.Version})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = doRequest(t, router, http.MethodPut, path, gin.H{"senderName": "alice", "messageContent": "second", "version": msg.Version})
+	expectStatus(t, w, http.StatusOK)
+
+	edited := lastUserMessage(t, decodeBody[lobbyData](t, w))
+	if edited.MessageString != "second" || edited.Version != msg.Version+1 || edited.EditedAt == nil {
+		t.Errorf("got %+v after the edit", edited)
+	}
+
+	// the version alice loaded is stale now
+	w = doRequest(t, router, http.MethodPut, path, gin.H{"senderName": "alice", "messageContent": "third", "version": msg.Version})
+	expectStatus(t, w, http.StatusConflict)
+}
+
+func TestDeleteMessage(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	msg := lastUserMessage(t, postTestMessage(t, router, id, "alice", "oops"))
+	path := "/message/" + strconv.Itoa(msg.Id)
+
+	w := doRequest(t, router, http.MethodDelete, path, gin.H{"senderName": "bob"})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = doRequest(t, router, http.MethodDelete, path, gin.H{"senderName": "alice"})
+	expectStatus(t, w, http.StatusOK)
+
+	w = doRequest(t, router, http.MethodGet, path, nil)
+	expectStatus(t, w, http.StatusOK)
+	if !decodeBody[message](t, w).Deleted {
+		t.Error("message is not marked deleted")
+	}
+
+	w = doRequest(t, router, http.MethodDelete, path, gin.H{"senderName": "alice"})
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestLeaveLobbyRemovesSender(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+
+	w := doRequest(t, router, http.MethodPost, "/leaveLobby", gin.H{"lobbyId": id, "name": "alice"})
+	expectStatus(t, w, http.StatusOK)
+
+	if exists, _ := mem.SenderExists(context.Background(), id, "alice"); exists {
+		t.Error("alice is still in the lobby")
+	}
+
+	w = doRequest(t, router, http.MethodPost, "/leaveLobby", gin.H{"lobbyId": "nope", "name": "alice"})
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+var errInsertFailed = errors.New("insert failed")
+
+// failingInsertStore is a memStore that can't insert messages
+type failingInsertStore struct {
+	*memStore
+}
+
+func (failingInsertStore) AddMessage(ctx context.Context, msg message) (message, lobbyData, error) {
+	return message{}, lobbyData{}, errInsertFailed
+}
+
+func (failingInsertStore) AddMessages(ctx context.Context, lobbyId string, messages []message) ([]message, lobbyData, error) {
+	return nil, lobbyData{}, errInsertFailed
+}
+
+func TestPostMessageInsertFailureWritesOneResponse(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+
+	store = failingInsertStore{mem}
+
+	w := doRequest(t, router, http.MethodPost, "/postMessage", gin.H{"lobbyId": id, "senderName": "alice", "messageContent": "hi"})
+	expectStatus(t, w, http.StatusInternalServerError)
+
+	// a second write would show up as another JSON value after the first
+	decoder := json.NewDecoder(w.Body)
+	var failure map[string]any
+	if err := decoder.Decode(&failure); err != nil {
+		t.Fatal(err)
+	}
+	if decoder.More() {
+		t.Errorf("more than one response was written: %s", w.Body.String())
+	}
+}
+
+func TestPostMessageRejectsBlankAndTrims(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+
+	for _, content := range []string{"", "   ", "\n\t "} {
+		w := doRequest(t, router, http.MethodPost, "/postMessage", gin.H{"lobbyId": id, "senderName": "alice", "messageContent": content})
+		expectStatus(t, w, http.StatusBadRequest)
+		if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_MESSAGE_EMPTY {
+			t.Errorf("posting %q: got code %v, want %s", content, code, ERR_MESSAGE_EMPTY)
+		}
+	}
+
+	msg := lastUserMessage(t, postTestMessage(t, router, id, "alice", " hi "))
+	if msg.MessageString != "hi" {
+		t.Errorf("got %q, want the message trimmed to \"hi\"", msg.MessageString)
+	}
+}
+
+func TestEnterLobbyRejectsBlankAndTrims(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+
+	for _, name := range []string{"", "   ", "\n\t "} {
+		w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": name})
+		expectStatus(t, w, http.StatusBadRequest)
+		if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_USERNAME_EMPTY {
+			t.Errorf("entering as %q: got code %v, want %s", name, code, ERR_USERNAME_EMPTY)
+		}
+	}
+
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": " alice "})
+	expectStatus(t, w, http.StatusOK)
+
+	senders := decodeBody[enterLobbyResponse](t, w).Senders
+	if len(senders) != 1 || senders[0].Username != "alice" {
+		t.Errorf("got senders %+v, want just alice with the spaces trimmed", senders)
+	}
+}
+
+func TestMessageContentComesBackEscaped(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	const payload = `<script>alert("hi")</script>`
+	const escaped = `&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;`
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	posted := lastUserMessage(t, postTestMessage(t, router, id, "alice", payload))
+	if posted.MessageString != escaped {
+		t.Errorf("postMessage: got %q, want %q", posted.MessageString, escaped)
+	}
+
+	w := doRequest(t, router, http.MethodGet, "/lobby/"+id, nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := lastUserMessage(t, decodeBody[lobbyData](t, w)).MessageString; got != escaped {
+		t.Errorf("GET /lobby/:id: got %q, want %q", got, escaped)
+	}
+
+	w = doRequest(t, router, http.MethodGet, "/message/"+strconv.Itoa(posted.Id), nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := decodeBody[message](t, w).MessageString; got != escaped {
+		t.Errorf("GET /message/:id: got %q, want %q", got, escaped)
+	}
+
+	w = doRequest(t, router, http.MethodGet, "/lobby/"+id+"?raw=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := lastUserMessage(t, decodeBody[lobbyData](t, w)).MessageString; got != payload {
+		t.Errorf("GET /lobby/:id?raw=true: got %q, want %q", got, payload)
+	}
+}
+
+func TestLengthLimitsCountCharacters(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+
+	// é is two bytes, so these are well over the limits in bytes
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": strings.Repeat("é", maxUsernameLen+1)})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	name := strings.Repeat("é", maxUsernameLen)
+	enterTestLobby(t, router, id, name)
+
+	// and emoji are four
+	w = doRequest(t, router, http.MethodPost, "/postMessage", gin.H{"lobbyId": id, "senderName": name, "messageContent": strings.Repeat("😀", maxMsgLen+1)})
+	expectStatus(t, w, http.StatusBadRequest)
+	if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_MESSAGE_TOO_LONG {
+		t.Errorf("got code %v, want %s", code, ERR_MESSAGE_TOO_LONG)
+	}
+
+	postTestMessage(t, router, id, name, strings.Repeat("😀", maxMsgLen))
+}
+
+func TestConcurrentJoinsForOneName(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+
+	const joins = 20
+	statuses := make(chan int, joins)
+
+	var wg sync.WaitGroup
+	for range joins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": "alice"}).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != joins-1 {
+		t.Errorf("got statuses %v, want one 200 and the rest 409", counts)
+	}
+
+	if count, _ := mem.CountSenders(context.Background(), id); count != 1 {
+		t.Errorf("lobby has %d senders, want 1", count)
+	}
+}
+
+func messageContents(messages []message) []string {
+	contents := []string{}
+	for _, msg := range messages {
+		contents = append(contents, msg.MessageString)
+	}
+	return contents
+}
+
+func TestMessagesComeBackInOrder(t *testing.T) {
+	useMemStore(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+
+	// imported out of order, with a tie on 100
+	req := newRequest(t, http.MethodPost, "/lobby/"+id+"/import", []gin.H{
+		{"senderName": "alice", "messageContent": "c", "timestamp": 300},
+		{"senderName": "alice", "messageContent": "a", "timestamp": 100},
+		{"senderName": "alice", "messageContent": "b", "timestamp": 200},
+		{"senderName": "alice", "messageContent": "a2", "timestamp": 100},
+	})
+	req.Header.Set("Authorization", "Bearer secret")
+	expectStatus(t, serve(router, req), http.StatusOK)
+
+	// by timestamp, then id for the tie
+	w := doRequest(t, router, http.MethodGet, "/lobby/"+id+"/messages", nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := messageContents(decodeBody[[]message](t, w)); !slices.Equal(got, []string{"a", "a2", "b", "c"}) {
+		t.Errorf("GET /lobby/:id/messages: got %v, want [a a2 b c]", got)
+	}
+
+	// the lobby itself goes by id, which is the order they were stored in
+	w = doRequest(t, router, http.MethodGet, "/lobby/"+id, nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := messageContents(decodeBody[lobbyData](t, w).Messages); !slices.Equal(got, []string{"c", "a", "b", "a2"}) {
+		t.Errorf("GET /lobby/:id: got %v, want [c a b a2]", got)
+	}
+}
+
+func setEditWindow(t *testing.T, seconds int) {
+	t.Helper()
+
+	previous := editWindowSeconds
+	editWindowSeconds = seconds
+	t.Cleanup(func() { editWindowSeconds = previous })
+}
+
+func TestEditWindowBoundary(t *testing.T) {
+	setEditWindow(t, 300)
+
+	for age, wantPassed := range map[int64]bool{0: false, 299: false, 300: false, 301: true, 86400: true} {
+		if passed := editWindowPassed(1_000_000, 1_000_000+age); passed != wantPassed {
+			t.Errorf("%ds old: got passed=%t, want %t", age, passed, wantPassed)
+		}
+	}
+
+	setEditWindow(t, 0)
+	if editWindowPassed(0, 1_000_000) {
+		t.Error("a zero window still expired an edit")
+	}
+}
+
+func TestEditMessageOutsideWindow(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+	setEditWindow(t, 300)
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	fresh := lastUserMessage(t, postTestMessage(t, router, id, "alice", "fresh"))
+
+	stale, _, err := mem.AddMessage(context.Background(), message{LobbyId: id, SenderName: "alice", MessageString: "stale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.mutex.Lock()
+	mem.messageLocked(stale.Id).Timestamp -= 301
+	mem.mutex.Unlock()
+
+	w := doRequest(t, router, http.MethodPut, "/message/"+strconv.Itoa(stale.Id), gin.H{"senderName": "alice", "messageContent": "edited", "version": stale.Version})
+	expectStatus(t, w, http.StatusForbidden)
+	if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_EDIT_WINDOW_PASSED {
+		t.Errorf("got code %v, want %s", code, ERR_EDIT_WINDOW_PASSED)
+	}
+
+	w = doRequest(t, router, http.MethodPut, "/message/"+strconv.Itoa(fresh.Id), gin.H{"senderName": "alice", "messageContent": "edited", "version": fresh.Version})
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestReactionNeedsSenderInLobby(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	msg := lastUserMessage(t, postTestMessage(t, router, id, "alice", "hi"))
+	path := "/message/" + strconv.Itoa(msg.Id) + "/react"
+
+	w := doRequest(t, router, http.MethodPost, path, gin.H{"senderName": "  ", "emoji": "👍"})
+	expectStatus(t, w, http.StatusBadRequest)
+	if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_USERNAME_EMPTY {
+		t.Errorf("got code %v, want %s", code, ERR_USERNAME_EMPTY)
+	}
+
+	w = doRequest(t, router, http.MethodPost, path, gin.H{"senderName": "mallory", "emoji": "👍"})
+	expectStatus(t, w, http.StatusNotFound)
+	if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_SENDER_NOT_FOUND {
+		t.Errorf("got code %v, want %s", code, ERR_SENDER_NOT_FOUND)
+	}
+
+	w = doRequest(t, router, http.MethodDelete, path, gin.H{"senderName": "mallory", "emoji": "👍"})
+	expectStatus(t, w, http.StatusNotFound)
+
+	w = doRequest(t, router, http.MethodPost, path, gin.H{"senderName": "alice", "emoji": "👍"})
+	expectStatus(t, w, http.StatusOK)
+
+	w = doRequest(t, router, http.MethodDelete, path, gin.H{"senderName": "alice", "emoji": "👍"})
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestCSVExportNeutralisesFormulas(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+	postTestMessage(t, router, id, "alice", `=HYPERLINK("http://evil.example","click")`)
+	postTestMessage(t, router, id, "alice", "- just a list item")
+
+	w := doRequest(t, router, http.MethodGet, "/lobby/"+id+"/export?format=csv", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []string
+	for _, record := range records[1:] {
+		if record[1] == "alice" {
+			contents = append(contents, record[2])
+		}
+	}
+
+	want := []string{`'=HYPERLINK("http://evil.example","click")`, "'- just a list item"}
+	if !slices.Equal(contents, want) {
+		t.Errorf("got %q, want %q", contents, want)
+	}
+}
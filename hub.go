@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const WS_WRITE_TIMEOUT = 5 * time.Second
+
+// how many events a client can fall behind before we drop it
+const SUBSCRIBER_BUFFER_SIZE = 32
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// apply the same origin allowlist as the CORS middleware
+	CheckOrigin: func(r *http.Request) bool {
+		if len(allowedOrigins) == 0 {
+			return true
+		}
+		return slices.Contains(allowedOrigins, r.Header.Get("Origin"))
+	},
+}
+
+// subscriber is anything that can be pushed lobby events: a websocket or an
+// SSE stream. send only queues, so it never waits on the network
+type subscriber interface {
+	send(v any) error
+	close()
+	// senderName is who connected, from ?name=, or "" for anonymous listeners.
+	// only touched under hubMutex
+	senderName() string
+	setSenderName(name string)
+}
+
+var errSubscriberBehind = errors.New("subscriber is too far behind")
+
+// eventQueue buffers events for the goroutine that writes to one client
+type eventQueue struct {
+	events    chan any
+	done      chan struct{}
+	closeOnce sync.Once
+	name      string
+}
+
+func newEventQueue(name string) eventQueue {
+	return eventQueue{events: make(chan any, SUBSCRIBER_BUFFER_SIZE), done: make(chan struct{}), name: name}
+}
+
+func (q *eventQueue) send(v any) error {
+	select {
+	case q.events <- v:
+		return nil
+	default:
+		return errSubscriberBehind
+	}
+}
+
+func (q *eventQueue) stop() {
+	q.closeOnce.Do(func() { close(q.done) })
+}
+
+func (q *eventQueue) senderName() string {
+	return q.name
+}
+
+func (q *eventQueue) setSenderName(name string) {
+	q.name = name
+}
+
+type wsSubscriber struct {
+	eventQueue
+	conn *websocket.Conn
+}
+
+func newWSSubscriber(conn *websocket.Conn, name string) *wsSubscriber {
+	return &wsSubscriber{eventQueue: newEventQueue(name), conn: conn}
+}
+
+// closing the conn also ends lobbySocket's read loop, which unsubscribes it
+func (s *wsSubscriber) close() {
+	s.stop()
+	s.conn.Close()
+}
+
+// writeEvents is the only thing that writes to the conn, so a slow client
+// only ever holds up itself
+func (s *wsSubscriber) writeEvents() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case event := <-s.events:
+			s.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+			if err := s.conn.WriteJSON(event); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// sseSubscriber queues events for its handler goroutine, which owns the
+// response writer
+type sseSubscriber struct {
+	eventQueue
+}
+
+func newSSESubscriber(name string) *sseSubscriber {
+	return &sseSubscriber{eventQueue: newEventQueue(name)}
+}
+
+func (s *sseSubscriber) close() {
+	s.stop()
+}
+
+var hubMutex sync.Mutex
+var lobbySubscribers = map[string][]subscriber{}
+
+func addSubscriber(lobbyId string, sub subscriber) {
+	hubMutex.Lock()
+	defer hubMutex.Unlock()
+
+	lobbySubscribers[lobbyId] = append(lobbySubscribers[lobbyId], sub)
+}
+
+func removeSubscriber(lobbyId string, sub subscriber) {
+	hubMutex.Lock()
+	defer hubMutex.Unlock()
+
+	removeSubscriberLocked(lobbyId, sub)
+}
+
+// caller must hold hubMutex
+func removeSubscriberLocked(lobbyId string, sub subscriber) {
+	subs := lobbySubscribers[lobbyId]
+	for i, other := range subs {
+		if other == sub {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+
+	if len(subs) == 0 {
+		delete(lobbySubscribers, lobbyId)
+	} else {
+		lobbySubscribers[lobbyId] = subs
+	}
+}
+
+// typingEvent is pushed when someone starts or stops typing
+type typingEvent struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	IsTyping bool   `json:"isTyping"`
+}
+
+func newTypingEvent(name string, isTyping bool) typingEvent {
+	return typingEvent{Type: "typing", Name: name, IsTyping: isTyping}
+}
+
+// broadcast queues v for every subscriber in the lobby, dropping any that
+// have fallen too far behind
+func broadcast(lobbyId string, v any) {
+	broadcastExcept(lobbyId, v, "")
+}
+
+// broadcastExcept skips subscriptions opened under skipName, for events that
+// would just echo back what that sender did. "" skips nobody. it never waits
+// on a client, so handlers can call it while holding msgMutex, which is what
+// keeps events in the order their changes were committed
+func broadcastExcept(lobbyId string, v any, skipName string) {
+	hubMutex.Lock()
+	subs := []subscriber{}
+	for _, sub := range lobbySubscribers[lobbyId] {
+		if skipName == "" || sub.senderName() != skipName {
+			subs = append(subs, sub)
+		}
+	}
+	hubMutex.Unlock()
+
+	for _, sub := range subs {
+		if err := sub.send(v); err != nil {
+			slog.Warn("dropping subscriber", "lobbyId", lobbyId, "error", err)
+			removeSubscriber(lobbyId, sub)
+			sub.close()
+		}
+	}
+}
+
+// disconnectSender closes every subscription opened under name in the lobby
+func disconnectSender(lobbyId string, name string) {
+	hubMutex.Lock()
+	defer hubMutex.Unlock()
+
+	subs := append([]subscriber{}, lobbySubscribers[lobbyId]...)
+	for _, sub := range subs {
+		if sub.senderName() == name {
+			removeSubscriberLocked(lobbyId, sub)
+			sub.close()
+		}
+	}
+}
+
+// renameSubscribers keeps a renamed sender's open connections attached to
+// them, so kicks and skip-self broadcasts still find them
+func renameSubscribers(lobbyId string, from string, to string) {
+	hubMutex.Lock()
+	defer hubMutex.Unlock()
+
+	for _, sub := range lobbySubscribers[lobbyId] {
+		if sub.senderName() == from {
+			sub.setSenderName(to)
+		}
+	}
+}
+
+// lobbyExistsForSubscribe does the existence check up front, since once a
+// socket or stream is open we can't send a normal error response
+func lobbyExistsForSubscribe(c *gin.Context, id string) bool {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	if exists, err := store.LobbyExists(ctx, id); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return false
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "Lobby does not exist!"})
+		return false
+	}
+
+	return true
+}
+
+func lobbySocket(c *gin.Context) {
+	id := c.Param("id")
+
+	if !lobbyExistsForSubscribe(c, id) {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade already wrote an error response
+		return
+	}
+
+	sub := newWSSubscriber(conn, c.Query("name"))
+	addSubscriber(id, sub)
+
+	defer func() {
+		removeSubscriber(id, sub)
+		sub.close()
+	}()
+
+	go sub.writeEvents()
+
+	// we don't expect anything from the client, but reading is how we notice it went away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// lobbyEvents is the Server-Sent Events version of lobbySocket, for clients
+// that only need to listen
+func lobbyEvents(c *gin.Context) {
+	id := c.Param("id")
+
+	if !lobbyExistsForSubscribe(c, id) {
+		return
+	}
+
+	sub := newSSESubscriber(c.Query("name"))
+	addSubscriber(id, sub)
+
+	defer func() {
+		removeSubscriber(id, sub)
+		sub.close()
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-sub.done:
+			return false
+		case event := <-sub.events:
+			c.SSEvent("message", event)
+			return true
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func subscribed(lobbyId string, sub subscriber) bool {
+	hubMutex.Lock()
+	defer hubMutex.Unlock()
+
+	for _, other := range lobbySubscribers[lobbyId] {
+		if other == sub {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBroadcastDropsSubscribersThatFallBehind(t *testing.T) {
+	slow := newSSESubscriber("slow")
+	fast := newSSESubscriber("fast")
+	addSubscriber("hubtest", slow)
+	addSubscriber("hubtest", fast)
+	t.Cleanup(func() {
+		removeSubscriber("hubtest", slow)
+		removeSubscriber("hubtest", fast)
+	})
+
+	// nothing reads from slow, so it fills up and gets dropped, while fast
+	// keeps draining and stays
+	for i := 0; i <= SUBSCRIBER_BUFFER_SIZE; i++ {
+		broadcast("hubtest", i)
+		<-fast.events
+	}
+
+	if subscribed("hubtest", slow) {
+		t.Error("slow subscriber is still subscribed after its buffer filled")
+	}
+	select {
+	case <-slow.done:
+	default:
+		t.Error("slow subscriber was not closed")
+	}
+
+	if !subscribed("hubtest", fast) {
+		t.Error("fast subscriber was dropped")
+	}
+}
+
+func TestBroadcastExceptSkipsSender(t *testing.T) {
+	alice := newSSESubscriber("alice")
+	bob := newSSESubscriber("bob")
+	addSubscriber("hubtest", alice)
+	addSubscriber("hubtest", bob)
+	t.Cleanup(func() {
+		removeSubscriber("hubtest", alice)
+		removeSubscriber("hubtest", bob)
+	})
+
+	broadcastExcept("hubtest", newTypingEvent("alice", true), "alice")
+
+	if len(alice.events) != 0 {
+		t.Error("alice got her own typing event")
+	}
+	if len(bob.events) != 1 {
+		t.Errorf("bob got %d events, want 1", len(bob.events))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// how long a retried postMessage with the same Idempotency-Key gets the
+// original result back instead of posting again
+const IDEMPOTENCY_KEY_TTL = 10 * time.Minute
+
+type idempotentResult struct {
+	result  lobbyData
+	expires time.Time
+}
+
+// idempotencyCache remembers the lobbyData each Idempotency-Key produced
+type idempotencyCache struct {
+	mutex   sync.Mutex
+	entries map[string]idempotentResult
+	ttl     time.Duration
+}
+
+var postIdempotency = newIdempotencyCache(IDEMPOTENCY_KEY_TTL)
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	cache := &idempotencyCache{entries: map[string]idempotentResult{}, ttl: ttl}
+	go cache.cleanup()
+	return cache
+}
+
+// idempotencyKey scopes the client's key to the lobby and sender, so two
+// clients picking the same key can't see each other's results
+func idempotencyKey(lobbyId string, senderName string, key string) string {
+	return lobbyId + "\x00" + senderName + "\x00" + key
+}
+
+func (cache *idempotencyCache) get(key string) (lobbyData, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return lobbyData{}, false
+	}
+
+	// copy the messages since respondLobby escapes them in place
+	result := entry.result
+	result.Messages = slices.Clone(result.Messages)
+	result.PinnedMessages = slices.Clone(result.PinnedMessages)
+	return result, true
+}
+
+func (cache *idempotencyCache) put(key string, result lobbyData) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	result.Messages = slices.Clone(result.Messages)
+	result.PinnedMessages = slices.Clone(result.PinnedMessages)
+	cache.entries[key] = idempotentResult{result: result, expires: time.Now().Add(cache.ttl)}
+}
+
+func (cache *idempotencyCache) cleanup() {
+	ticker := time.NewTicker(cache.ttl)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+
+		cache.mutex.Lock()
+		for key, entry := range cache.entries {
+			if now.After(entry.expires) {
+				delete(cache.entries, key)
+			}
+		}
+		cache.mutex.Unlock()
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_IMPORT_MESSAGES = 10000
+
+// rows per multi-row INSERT, well under MySQL's placeholder limit
+const IMPORT_BATCH_SIZE = 500
+
+type importedMessage struct {
+	SenderName    string `json:"senderName"`
+	MessageString string `json:"messageContent"`
+	Timestamp     int64  `json:"timestamp"` // unix seconds, 0 means now
+	// position in the request, for reporting skips after validation
+	index int
+}
+
+type skippedImport struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// parseCSVImport reads the same columns exportLobby writes (id is ignored),
+// so an export can be loaded straight back in. timestamps can be RFC 3339 or
+// unix seconds
+func parseCSVImport(r io.Reader) ([]importedMessage, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	senderCol, hasSender := columns["sender"]
+	contentCol, hasContent := columns["content"]
+	timestampCol, hasTimestamp := columns["timestamp"]
+	if !hasSender || !hasContent {
+		return nil, errors.New("header needs sender and content columns")
+	}
+
+	messages := make([]importedMessage, 0, len(records)-1)
+	for _, record := range records[1:] {
+		msg := importedMessage{SenderName: record[senderCol], MessageString: record[contentCol]}
+
+		if hasTimestamp && record[timestampCol] != "" {
+			if parsed, err := time.Parse(time.RFC3339, record[timestampCol]); err == nil {
+				msg.Timestamp = parsed.Unix()
+			} else if unix, err := strconv.ParseInt(record[timestampCol], 10, 64); err == nil {
+				msg.Timestamp = unix
+			} else {
+				// let validation skip it instead of failing the whole file
+				msg.Timestamp = -1
+			}
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// validateImport trims what it keeps and says why it dropped the rest
+func validateImport(messages []importedMessage) ([]importedMessage, []skippedImport) {
+	valid := []importedMessage{}
+	skipped := []skippedImport{}
+	now := time.Now().Unix()
+
+	for i, msg := range messages {
+		msg.index = i
+		msg.SenderName = strings.TrimSpace(msg.SenderName)
+		msg.MessageString = strings.TrimSpace(msg.MessageString)
+
+		reason := ""
+		switch {
+		case msg.SenderName == "":
+			reason = "senderName is empty"
+		case utf8.RuneCountInString(msg.SenderName) > maxUsernameLen:
+			reason = "senderName is too long"
+		case isReservedName(msg.SenderName):
+			reason = "senderName is reserved"
+		case msg.MessageString == "":
+			reason = "messageContent is empty"
+		case utf8.RuneCountInString(msg.MessageString) > maxMsgLen:
+			reason = "messageContent is too long"
+		case msg.Timestamp < 0 || msg.Timestamp > now:
+			reason = "timestamp is invalid"
+		}
+
+		// the blocklist applies the same as to posts and edits
+		if reason == "" {
+			filtered, allowed := filterMessage(msg.MessageString)
+			if !allowed {
+				reason = "messageContent contains a blocked word"
+			}
+			msg.MessageString = filtered
+		}
+
+		if reason != "" {
+			skipped = append(skipped, skippedImport{Index: i, Reason: reason})
+			continue
+		}
+
+		if msg.Timestamp == 0 {
+			msg.Timestamp = now
+		}
+		valid = append(valid, msg)
+	}
+
+	return valid, skipped
+}
+
+// capImportSenders skips messages from senders who aren't in the lobby yet
+// once adding them would go over MAX_SENDERS_PER_LOBBY, the same as if they
+// had tried to enter
+func capImportSenders(messages []importedMessage, skipped []skippedImport, existing []sender) ([]importedMessage, []skippedImport) {
+	if maxSendersPerLobby <= 0 {
+		return messages, skipped
+	}
+
+	allowed := map[string]bool{}
+	for _, sndr := range existing {
+		allowed[sndr.Username] = true
+	}
+	count := len(allowed)
+
+	kept := []importedMessage{}
+	for _, msg := range messages {
+		if !allowed[msg.SenderName] {
+			if count >= maxSendersPerLobby {
+				skipped = append(skipped, skippedImport{Index: msg.index, Reason: "lobby is full"})
+				continue
+			}
+			allowed[msg.SenderName] = true
+			count++
+		}
+		kept = append(kept, msg)
+	}
+
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Index < skipped[j].Index })
+	return kept, skipped
+}
+
+// insertImport adds any senders that aren't in the lobby yet, then the
+// messages, IMPORT_BATCH_SIZE rows per statement
+func insertImport(ctx context.Context, q querier, lobbyId string, messages []importedMessage) error {
+	// senders are marked as last seen at their newest imported message, so the
+	// idle reaper treats them like anyone else who went quiet
+	lastSeen := map[string]int64{}
+	names := []string{}
+	for _, msg := range messages {
+		if _, ok := lastSeen[msg.SenderName]; !ok {
+			names = append(names, msg.SenderName)
+		}
+		lastSeen[msg.SenderName] = max(lastSeen[msg.SenderName], msg.Timestamp)
+	}
+
+	for start := 0; start < len(names); start += IMPORT_BATCH_SIZE {
+		batch := names[start:min(start+IMPORT_BATCH_SIZE, len(names))]
+
+		args := make([]any, 0, len(batch)*3)
+		for _, name := range batch {
+			args = append(args, name, lobbyId, lastSeen[name])
+		}
+
+		query := "INSERT INTO sender (name, lobbyId, lastSeen) VALUES " + placeholderRows(len(batch), 3) + " ON DUPLICATE KEY UPDATE name = name"
+		if _, err := q.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("import senders into %q: %w", lobbyId, err)
+		}
+	}
+
+	for start := 0; start < len(messages); start += IMPORT_BATCH_SIZE {
+		batch := messages[start:min(start+IMPORT_BATCH_SIZE, len(messages))]
+
+		args := make([]any, 0, len(batch)*4)
+		for _, msg := range batch {
+			stored, err := encryptMessage(msg.MessageString)
+			if err != nil {
+				return err
+			}
+			args = append(args, lobbyId, msg.SenderName, stored, msg.Timestamp)
+		}
+
+		query := "INSERT INTO message (lobbyId, senderName, messageString, timestamp) VALUES " + placeholderRows(len(batch), 4)
+		if _, err := q.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("import messages into %q: %w", lobbyId, err)
+		}
+	}
+
+	return nil
+}
+
+// placeholderRows builds "(?, ?), (?, ?)" for a multi-row insert
+func placeholderRows(rows int, columns int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", columns), ", ") + ")"
+	return strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+// importLobby bulk-loads messages from a JSON array, or CSV in the export's
+// format when sent as text/csv. all valid rows go in together or not at all
+func importLobby(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+
+	var messages []importedMessage
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	if mediaType == "text/csv" {
+		parsed, err := parseCSVImport(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse CSV: " + err.Error()})
+			return
+		}
+		messages = parsed
+	} else if err := c.BindJSON(&messages); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return
+	}
+
+	if len(messages) > MAX_IMPORT_MESSAGES {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_IMPORT_TOO_LARGE, "message": "Too many messages in one import!", "max": MAX_IMPORT_MESSAGES})
+		return
+	}
+
+	valid, skipped := validateImport(messages)
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	if exists, err := store.LobbyExists(ctx, id); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "lobby not found"})
+		return
+	}
+
+	valid, skipped, err := store.ImportMessages(ctx, id, valid, skipped)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{"imported": len(valid), "skipped": skipped})
+}
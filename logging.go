@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type loggerKey struct{}
+
+// setupLogging makes slog (and the plain log package, which routes through it)
+// emit JSON at LOG_LEVEL, defaulting to info
+func setupLogging() {
+	var level slog.Level
+
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(raw))); err != nil {
+			fmt.Fprintf(os.Stderr, "LOG_LEVEL must be debug, info, warn or error, got %q\n", raw)
+			os.Exit(1)
+		}
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %v", err))
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// loggerFrom returns the request's logger if ctx came from a request, so its
+// lines carry the request id
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestLogging tags each request with an id, returned as X-Request-ID, and
+// writes one access log line when it finishes
+func requestLogging() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := newRequestID()
+
+		logger := slog.Default().With("requestId", id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), loggerKey{}, logger))
+		c.Header("X-Request-ID", id)
+
+		c.Next()
+
+		logger.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latencyMs", time.Since(start).Milliseconds(),
+			"clientIp", c.ClientIP(),
+		)
+	}
+}
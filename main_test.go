@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRow hands out values by column name, in whatever order columns lists
+// them, the way a database would for an explicit select list
+type fakeRow struct {
+	columns []string
+	values  map[string]any
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(r.columns) {
+		return fmt.Errorf("%d destinations for %d columns", len(dest), len(r.columns))
+	}
+
+	for i, column := range r.columns {
+		value, ok := r.values[column]
+		if !ok {
+			return fmt.Errorf("no value for column %q", column)
+		}
+
+		if scanner, ok := dest[i].(sql.Scanner); ok {
+			if err := scanner.Scan(value); err != nil {
+				return fmt.Errorf("column %q: %w", column, err)
+			}
+			continue
+		}
+
+		target := reflect.ValueOf(dest[i]).Elem()
+		if !reflect.TypeOf(value).AssignableTo(target.Type()) {
+			return fmt.Errorf("column %q: can't put %T in %s", column, value, target.Type())
+		}
+		target.Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func splitColumns(list string) []string {
+	columns := strings.Split(list, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+func TestScanMessageMatchesColumns(t *testing.T) {
+	editedAt := int64(1700000100)
+	replyToId := 3
+	clientMessageId := "local-1"
+
+	row := fakeRow{
+		columns: splitColumns(MESSAGE_COLUMNS),
+		values: map[string]any{
+			"id":              7,
+			"lobbyId":         "lobby",
+			"senderName":      "alice",
+			"messageString":   "hello @bob",
+			"timestamp":       int64(1700000000),
+			"editedAt":        &editedAt,
+			"replyToId":       &replyToId,
+			"mentions":        []byte(`["bob"]`),
+			"deleted":         false,
+			"pinned":          true,
+			"version":         2,
+			"clientMessageId": &clientMessageId,
+			"type":            MESSAGE_TYPE_USER,
+		},
+	}
+
+	var msg message
+	if err := scanMessage(row, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := message{
+		Id:              7,
+		LobbyId:         "lobby",
+		SenderName:      "alice",
+		MessageString:   "hello @bob",
+		Timestamp:       1700000000,
+		EditedAt:        &editedAt,
+		ReplyToId:       &replyToId,
+		Mentions:        mentionList{"bob"},
+		Pinned:          true,
+		Version:         2,
+		ClientMessageId: &clientMessageId,
+		Type:            MESSAGE_TYPE_USER,
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("got %+v, want %+v", msg, want)
+	}
+}
+
+func TestScanSenderMatchesColumns(t *testing.T) {
+	// everything before the unread count subquery is a plain column
+	selectList, _, _ := strings.Cut(strings.TrimSpace(SENDER_SELECT), "(SELECT")
+	columns := splitColumns(strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(selectList, "SELECT")), ","))
+
+	color := "#ff0000"
+	lastRead := 4
+
+	row := fakeRow{
+		columns: append(columns, "unreadCount"),
+		values: map[string]any{
+			"name":              "alice",
+			"lobbyId":           "lobby",
+			"isTyping":          true,
+			"lastSeen":          int64(1700000000),
+			"color":             &color,
+			"avatarUrl":         (*string)(nil),
+			"lastReadMessageId": &lastRead,
+			"unreadCount":       2,
+		},
+	}
+
+	var sndr sender
+	if err := scanSender(row, &sndr); err != nil {
+		t.Fatal(err)
+	}
+
+	want := sender{
+		Username:          "alice",
+		LobbyId:           "lobby",
+		IsTyping:          true,
+		LastSeen:          1700000000,
+		Color:             &color,
+		LastReadMessageId: &lastRead,
+		UnreadCount:       2,
+	}
+	if !reflect.DeepEqual(sndr, want) {
+		t.Errorf("got %+v, want %+v", sndr, want)
+	}
+}
+
+func TestHealthReportsUnreachableDatabase(t *testing.T) {
+	closed, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:3306)/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	previousDb, previousStore := db, store
+	db, store = closed, mysqlStore{}
+	t.Cleanup(func() { db, store = previousDb, previousStore })
+
+	w := doRequest(t, newRouter(), http.MethodGet, "/health", nil)
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if status := decodeBody[map[string]string](t, w)["status"]; status != "db unreachable" {
+		t.Errorf("got status %q, want \"db unreachable\"", status)
+	}
+}
+
+func TestHealthOk(t *testing.T) {
+	useMemStore(t)
+
+	w := doRequest(t, newRouter(), http.MethodGet, "/health", nil)
+	expectStatus(t, w, http.StatusOK)
+	if status := decodeBody[map[string]string](t, w)["status"]; status != "ok" {
+		t.Errorf("got status %q, want \"ok\"", status)
+	}
+}
+
+func TestCorsOnlyAllowsListedOrigins(t *testing.T) {
+	useMemStore(t)
+	t.Setenv("ALLOWED_ORIGINS", "https://chat.example.com")
+	previous := allowedOrigins
+	t.Cleanup(func() { allowedOrigins = previous })
+
+	router := newRouter()
+
+	for origin, wantAllowed := range map[string]bool{
+		"https://chat.example.com": true,
+		"https://evil.example.com": false,
+	} {
+		req := newRequest(t, http.MethodGet, "/health", nil)
+		req.Header.Set("Origin", origin)
+		w := serve(router, req)
+
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if wantAllowed && got != origin {
+			t.Errorf("origin %s: got Access-Control-Allow-Origin %q, want it echoed", origin, got)
+		} else if !wantAllowed && got != "" {
+			t.Errorf("origin %s: got Access-Control-Allow-Origin %q, want none", origin, got)
+		}
+	}
+}
+
+func TestCorsPreflightAllowsCustomHeaders(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "https://chat.example.com")
+	previous := allowedOrigins
+	t.Cleanup(func() { allowedOrigins = previous })
+
+	req := newRequest(t, http.MethodOptions, "/postMessage", nil)
+	req.Header.Set("Origin", "https://chat.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "Idempotency-Key, "+SESSION_TOKEN_HEADER)
+	w := serve(newRouter(), req)
+
+	allowed := strings.ToLower(w.Header().Get("Access-Control-Allow-Headers"))
+	for _, header := range []string{"idempotency-key", strings.ToLower(SESSION_TOKEN_HEADER)} {
+		if !strings.Contains(allowed, header) {
+			t.Errorf("preflight allows %q, want %s in it", allowed, header)
+		}
+	}
+}
+
+// collidingStore says the first collisions ids it's asked about are taken,
+// and remembers every id it was asked about
+type collidingStore struct {
+	*memStore
+	collisions int
+	checked    []string
+}
+
+func (s *collidingStore) LobbyExists(ctx context.Context, id string) (bool, error) {
+	s.checked = append(s.checked, id)
+	return len(s.checked) <= s.collisions, nil
+}
+
+func TestUniqueLobbyIdGivesUpAfterAttempts(t *testing.T) {
+	colliding := &collidingStore{memStore: useMemStore(t), collisions: 5}
+	store = colliding
+
+	if _, err := uniqueLobbyId(context.Background(), 5); !errors.Is(err, errNoUniqueLobbyId) {
+		t.Errorf("got error %v, want errNoUniqueLobbyId", err)
+	}
+	if len(colliding.checked) != 5 {
+		t.Errorf("checked %d ids, want 5", len(colliding.checked))
+	}
+}
+
+func TestUniqueLobbyIdUsesTheIdItChecked(t *testing.T) {
+	colliding := &collidingStore{memStore: useMemStore(t), collisions: 4}
+	store = colliding
+
+	id, err := uniqueLobbyId(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last attempt is the only one that was free
+	if len(colliding.checked) != 5 || id != colliding.checked[4] {
+		t.Errorf("got %q after checking %v, want the fifth id checked", id, colliding.checked)
+	}
+}
+
+func TestCreateLobbyFailsWhenEveryIdCollides(t *testing.T) {
+	mem := useMemStore(t)
+	store = &collidingStore{memStore: mem, collisions: lobbyIdAttempts}
+
+	w := doRequest(t, newRouter(), http.MethodPost, "/createLobby", nil)
+	expectStatus(t, w, http.StatusInternalServerError)
+
+	if count, _ := mem.CountLobbies(context.Background()); count != 0 {
+		t.Errorf("%d lobbies were created with a colliding id", count)
+	}
+}
+
+func TestSetupLimitsDoesNotStackDigits(t *testing.T) {
+	saved := letters
+	t.Cleanup(func() { letters = saved })
+	t.Setenv("LOBBY_ID_DIGITS", "true")
+
+	for range 2 {
+		if err := setupLimits(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if string(letters) != lowercase+digits {
+		t.Errorf("got alphabet %q, want %q", string(letters), lowercase+digits)
+	}
+}
@@ -0,0 +1,875 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memStore is a Store that keeps everything in memory, so handlers can be
+// exercised without MySQL. it aims to behave like mysqlStore for everything
+// a handler can see, not to be fast
+type memStore struct {
+	mutex     sync.Mutex
+	lobbies   map[string]*memLobby
+	messages  []message // in id order
+	lastId    int
+	senders   []*memSender
+	reactions []memReaction
+}
+
+type memLobby struct {
+	// only Id, CreatedAt, Name and the settings are used
+	info         lobbyData
+	passwordHash *string
+	creatorIp    string
+	restoredAt   int64
+}
+
+type memSender struct {
+	sender
+	sessionTokenHash *string
+}
+
+type memReaction struct {
+	messageId  int
+	senderName string
+	emoji      string
+}
+
+func newMemStore() *memStore {
+	return &memStore{lobbies: map[string]*memLobby{}}
+}
+
+func (s *memStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memStore) LobbyExists(ctx context.Context, id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.lobbies[id]
+	return ok, nil
+}
+
+func (s *memStore) GetLobby(ctx context.Context, id string) (lobbyData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lobbyLocked(id, s.lobbyMessagesLocked(id))
+}
+
+func (s *memStore) GetLobbyPage(ctx context.Context, id string, before int, limit int) (lobbyData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	older := []message{}
+	for _, msg := range s.lobbyMessagesLocked(id) {
+		if before <= 0 || msg.Id < before {
+			older = append(older, msg)
+		}
+	}
+
+	hasMore := len(older) > limit
+	if hasMore {
+		older = older[len(older)-limit:]
+	}
+
+	lobby, err := s.lobbyLocked(id, older)
+	if err != nil {
+		return lobbyData{}, err
+	}
+
+	lobby.HasMore = hasMore
+	if hasMore && len(older) > 0 {
+		cursor := encodeCursor(older[0].Id)
+		lobby.NextCursor = &cursor
+	}
+	return lobby, nil
+}
+
+func (s *memStore) GetLobbyInfo(ctx context.Context, id string) (lobbyData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lobby, ok := s.lobbies[id]
+	if !ok {
+		return lobbyData{}, errLobbyNotFound
+	}
+	return lobby.info, nil
+}
+
+func (s *memStore) GetLobbySettings(ctx context.Context, id string) (lobbySettings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lobby, ok := s.lobbies[id]
+	if !ok {
+		return lobbySettings{}, errLobbyNotFound
+	}
+	return lobby.info.lobbySettings, nil
+}
+
+func (s *memStore) SetLobbySettings(ctx context.Context, id string, settings lobbySettings) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if lobby, ok := s.lobbies[id]; ok {
+		// archived has its own method
+		settings.Archived = lobby.info.Archived
+		lobby.info.lobbySettings = settings
+	}
+	return nil
+}
+
+func (s *memStore) SetLobbyName(ctx context.Context, id string, name *string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if lobby, ok := s.lobbies[id]; ok {
+		lobby.info.Name = clonePointer(name)
+	}
+	return nil
+}
+
+func (s *memStore) SetLobbyArchived(ctx context.Context, id string, archived bool) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lobby, ok := s.lobbies[id]
+	if !ok {
+		return false, nil
+	}
+
+	lobby.info.Archived = archived
+	if !archived {
+		lobby.restoredAt = time.Now().Unix()
+	}
+	return true, nil
+}
+
+func (s *memStore) GetLobbyPasswordHash(ctx context.Context, id string) (*string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lobby, ok := s.lobbies[id]
+	if !ok {
+		return nil, fmt.Errorf("get password for lobby %q: %w", id, errLobbyNotFound)
+	}
+	return clonePointer(lobby.passwordHash), nil
+}
+
+func (s *memStore) AddLobby(ctx context.Context, id string, passwordHash *string, name *string, creatorIp string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.lobbies[id]; ok {
+		return fmt.Errorf("insert lobby: %q already exists", id)
+	}
+
+	s.lobbies[id] = &memLobby{
+		info:         lobbyData{Id: id, CreatedAt: time.Now().Unix(), Name: clonePointer(name)},
+		passwordHash: clonePointer(passwordHash),
+		creatorIp:    creatorIp,
+	}
+	return nil
+}
+
+func (s *memStore) CountLobbies(ctx context.Context) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.lobbies), nil
+}
+
+func (s *memStore) CountLobbiesByIp(ctx context.Context, ip string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, lobby := range s.lobbies {
+		if lobby.creatorIp == ip && !lobby.info.Archived {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memStore) GetLobbySummaries(ctx context.Context) ([]lobbySummary, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	summaries := []lobbySummary{}
+	for id, lobby := range s.lobbies {
+		summaries = append(summaries, lobbySummary{
+			Id:           id,
+			SenderCount:  len(s.lobbySendersLocked(id)),
+			MessageCount: len(s.lobbyMessagesLocked(id)),
+			CreatedAt:    lobby.info.CreatedAt,
+		})
+	}
+
+	slices.SortFunc(summaries, func(a, b lobbySummary) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), cmp.Compare(a.Id, b.Id))
+	})
+	return summaries, nil
+}
+
+func (s *memStore) GetMessagesSince(ctx context.Context, lobbyId string, since int64, msgType string) ([]message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages := []message{}
+	for _, msg := range s.lobbyMessagesLocked(lobbyId) {
+		if msg.Timestamp > since && (msgType == "" || msg.Type == msgType) {
+			messages = append(messages, msg)
+		}
+	}
+
+	slices.SortStableFunc(messages, func(a, b message) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+	return s.withExtrasLocked(messages), nil
+}
+
+func (s *memStore) GetMessage(ctx context.Context, id int) (message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	msg := s.messageLocked(id)
+	if msg == nil {
+		return message{}, errMessageNotFound
+	}
+	return s.withExtrasLocked([]message{*msg})[0], nil
+}
+
+func (s *memStore) EachMessage(ctx context.Context, lobbyId string, fn func(message) error) error {
+	s.mutex.Lock()
+	messages := s.lobbyMessagesLocked(lobbyId)
+	s.mutex.Unlock()
+
+	for _, msg := range messages {
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) CountMessages(ctx context.Context, lobbyId string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.lobbyMessagesLocked(lobbyId)), nil
+}
+
+func (s *memStore) AddMessage(ctx context.Context, msg message) (message, lobbyData, error) {
+	inserted, lobby, err := s.AddMessages(ctx, msg.LobbyId, []message{msg})
+	if err != nil {
+		return message{}, lobbyData{}, err
+	}
+
+	return inserted[0], lobby, nil
+}
+
+func (s *memStore) AddMessages(ctx context.Context, lobbyId string, messages []message) ([]message, lobbyData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	senders := s.lobbySendersLocked(lobbyId)
+
+	inserted := make([]message, 0, len(messages))
+	for _, msg := range messages {
+		msg.Mentions = parseMentions(msg.MessageString, senders)
+		inserted = append(inserted, s.appendLocked(msg))
+
+		if sndr := s.senderLocked(lobbyId, msg.SenderName); sndr != nil {
+			sndr.LastSeen = time.Now().Unix()
+		}
+	}
+
+	lobby, err := s.lobbyLocked(lobbyId, s.lobbyMessagesLocked(lobbyId))
+	if err != nil {
+		return nil, lobbyData{}, err
+	}
+
+	return inserted, lobby, nil
+}
+
+func (s *memStore) AddSystemMessage(ctx context.Context, msg message) (message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.appendLocked(msg), nil
+}
+
+func (s *memStore) UpdateMessageContent(ctx context.Context, id int, version int, content string, mentions mentionList) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	msg := s.messageLocked(id)
+	if msg == nil || msg.Version != version {
+		return false, nil
+	}
+
+	editedAt := time.Now().Unix()
+	msg.MessageString = content
+	msg.EditedAt = &editedAt
+	msg.Mentions = slices.Clone(mentions)
+	msg.Version++
+	return true, nil
+}
+
+func (s *memStore) DeleteMessage(ctx context.Context, id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reactions = slices.DeleteFunc(s.reactions, func(r memReaction) bool { return r.messageId == id })
+
+	if msg := s.messageLocked(id); msg != nil {
+		msg.Deleted = true
+		msg.Pinned = false
+	}
+	return nil
+}
+
+func (s *memStore) ClearLobby(ctx context.Context, lobbyId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deleteMessagesLocked(func(msg message) bool { return msg.LobbyId == lobbyId })
+
+	for _, sndr := range s.lobbySendersLocked(lobbyId) {
+		s.senderLocked(lobbyId, sndr.Username).LastReadMessageId = nil
+	}
+	return nil
+}
+
+func (s *memStore) ImportMessages(ctx context.Context, lobbyId string, messages []importedMessage, skipped []skippedImport) ([]importedMessage, []skippedImport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages, skipped = capImportSenders(messages, skipped, s.lobbySendersLocked(lobbyId))
+
+	for _, imported := range messages {
+		sndr := s.senderLocked(lobbyId, imported.SenderName)
+		if sndr == nil {
+			sndr = &memSender{sender: sender{Username: imported.SenderName, LobbyId: lobbyId}}
+			s.senders = append(s.senders, sndr)
+		}
+		sndr.LastSeen = max(sndr.LastSeen, imported.Timestamp)
+
+		s.lastId++
+		s.messages = append(s.messages, message{
+			Id:            s.lastId,
+			LobbyId:       lobbyId,
+			SenderName:    imported.SenderName,
+			MessageString: imported.MessageString,
+			Timestamp:     imported.Timestamp,
+			Version:       1,
+			Type:          MESSAGE_TYPE_USER,
+		})
+	}
+
+	if maxMessagesPerLobby > 0 {
+		s.trimLocked(lobbyId, maxMessagesPerLobby)
+	}
+
+	return messages, skipped, nil
+}
+
+func (s *memStore) IsDuplicateMessage(ctx context.Context, msg message, since int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, other := range s.lobbyMessagesLocked(msg.LobbyId) {
+		if other.SenderName == msg.SenderName && other.Timestamp >= since && !other.Deleted && other.MessageString == msg.MessageString {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memStore) LastPostTime(ctx context.Context, lobbyId string, senderName string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var last int64
+	for _, msg := range s.lobbyMessagesLocked(lobbyId) {
+		if msg.SenderName == senderName {
+			last = max(last, msg.Timestamp)
+		}
+	}
+	return last, nil
+}
+
+func (s *memStore) CountPins(ctx context.Context, lobbyId string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, msg := range s.lobbyMessagesLocked(lobbyId) {
+		if msg.Pinned {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memStore) SetPinned(ctx context.Context, id int, pinned bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if msg := s.messageLocked(id); msg != nil {
+		msg.Pinned = pinned
+	}
+	return nil
+}
+
+func (s *memStore) AddReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	reaction := memReaction{messageId: messageId, senderName: senderName, emoji: emoji}
+	if slices.Contains(s.reactions, reaction) {
+		return false, nil
+	}
+
+	s.reactions = append(s.reactions, reaction)
+	return true, nil
+}
+
+func (s *memStore) RemoveReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	reaction := memReaction{messageId: messageId, senderName: senderName, emoji: emoji}
+	i := slices.Index(s.reactions, reaction)
+	if i < 0 {
+		return false, nil
+	}
+
+	s.reactions = slices.Delete(s.reactions, i, i+1)
+	return true, nil
+}
+
+func (s *memStore) SenderExists(ctx context.Context, lobbyId string, name string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.senderLocked(lobbyId, name) != nil, nil
+}
+
+func (s *memStore) GetSenders(ctx context.Context, lobbyId string) ([]sender, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lobbySendersLocked(lobbyId), nil
+}
+
+func (s *memStore) GetSenderPage(ctx context.Context, lobbyId string, limit int, offset int) ([]sender, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	senders := s.lobbySendersLocked(lobbyId)
+	slices.SortFunc(senders, func(a, b sender) int { return cmp.Compare(a.Username, b.Username) })
+
+	senders = senders[min(offset, len(senders)):]
+	hasMore := len(senders) > limit
+	if hasMore {
+		senders = senders[:limit]
+	}
+	return senders, hasMore, nil
+}
+
+func (s *memStore) GetTypingNames(ctx context.Context, lobbyId string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := []string{}
+	for _, sndr := range s.lobbySendersLocked(lobbyId) {
+		if sndr.IsTyping {
+			names = append(names, sndr.Username)
+		}
+	}
+
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *memStore) CountSenders(ctx context.Context, lobbyId string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.lobbySendersLocked(lobbyId)), nil
+}
+
+func (s *memStore) InsertSender(ctx context.Context, sndr sender, sessionTokenHash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.senderLocked(sndr.LobbyId, sndr.Username) != nil {
+		return errUsernameTaken
+	}
+
+	s.senders = append(s.senders, &memSender{
+		sender: sender{
+			Username:  sndr.Username,
+			LobbyId:   sndr.LobbyId,
+			LastSeen:  time.Now().Unix(),
+			Color:     clonePointer(sndr.Color),
+			AvatarUrl: clonePointer(sndr.AvatarUrl),
+		},
+		sessionTokenHash: &sessionTokenHash,
+	})
+	return nil
+}
+
+func (s *memStore) SetSenderProfile(ctx context.Context, sndr sender) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := s.senderLocked(sndr.LobbyId, sndr.Username)
+	if stored == nil {
+		return nil
+	}
+
+	if sndr.Color != nil {
+		stored.Color = clonePointer(sndr.Color)
+	}
+	if sndr.AvatarUrl != nil {
+		stored.AvatarUrl = clonePointer(sndr.AvatarUrl)
+	}
+	return nil
+}
+
+func (s *memStore) RemoveSender(ctx context.Context, lobbyId string, name string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	before := len(s.senders)
+	s.senders = slices.DeleteFunc(s.senders, func(sndr *memSender) bool {
+		return sndr.LobbyId == lobbyId && sndr.Username == name
+	})
+	return len(s.senders) < before, nil
+}
+
+func (s *memStore) RenameSender(ctx context.Context, lobbyId string, from string, to string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.senderLocked(lobbyId, to) != nil {
+		return errUsernameTaken
+	}
+
+	sndr := s.senderLocked(lobbyId, from)
+	if sndr == nil {
+		return errSenderNotFound
+	}
+	sndr.Username = to
+
+	inLobby := map[int]bool{}
+	for i := range s.messages {
+		msg := &s.messages[i]
+		if msg.LobbyId != lobbyId {
+			continue
+		}
+
+		inLobby[msg.Id] = true
+		if msg.SenderName == from && msg.Type == MESSAGE_TYPE_USER {
+			msg.SenderName = to
+		}
+	}
+
+	// same as the UPDATE IGNORE: a reaction the new name already made wins
+	reactions := []memReaction{}
+	for _, r := range s.reactions {
+		if inLobby[r.messageId] && r.senderName == from {
+			r.senderName = to
+			if slices.Contains(s.reactions, r) || slices.Contains(reactions, r) {
+				continue
+			}
+		}
+		reactions = append(reactions, r)
+	}
+	s.reactions = reactions
+
+	return nil
+}
+
+func (s *memStore) TouchSender(ctx context.Context, lobbyId string, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sndr := s.senderLocked(lobbyId, name); sndr != nil {
+		sndr.LastSeen = time.Now().Unix()
+	}
+	return nil
+}
+
+func (s *memStore) SetTyping(ctx context.Context, lobbyId string, name string, isTyping bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sndr := s.senderLocked(lobbyId, name); sndr != nil {
+		sndr.IsTyping = isTyping
+	}
+	return nil
+}
+
+func (s *memStore) GetSessionTokenHash(ctx context.Context, lobbyId string, name string) (*string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sndr := s.senderLocked(lobbyId, name)
+	if sndr == nil {
+		return nil, nil
+	}
+	return clonePointer(sndr.sessionTokenHash), nil
+}
+
+func (s *memStore) SetLastRead(ctx context.Context, lobbyId string, name string, messageId int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sndr := s.senderLocked(lobbyId, name)
+	if sndr == nil {
+		return nil
+	}
+
+	if sndr.LastReadMessageId == nil || *sndr.LastReadMessageId < messageId {
+		sndr.LastReadMessageId = &messageId
+	}
+	return nil
+}
+
+func (s *memStore) ReapLobbiesIdleSince(ctx context.Context, cutoff int64) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	reaped := 0
+	for id := range s.lobbies {
+		if s.lastActiveLocked(id) >= cutoff {
+			continue
+		}
+
+		s.deleteMessagesLocked(func(msg message) bool { return msg.LobbyId == id })
+		s.senders = slices.DeleteFunc(s.senders, func(sndr *memSender) bool { return sndr.LobbyId == id })
+		delete(s.lobbies, id)
+		reaped++
+	}
+	return reaped, nil
+}
+
+func (s *memStore) ArchiveLobbiesIdleSince(ctx context.Context, cutoff int64) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var archived int64
+	for id, lobby := range s.lobbies {
+		if !lobby.info.Archived && s.lastActiveLocked(id) < cutoff {
+			lobby.info.Archived = true
+			archived++
+		}
+	}
+	return archived, nil
+}
+
+func (s *memStore) ReapSendersIdleSince(ctx context.Context, cutoff int64) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	before := len(s.senders)
+	s.senders = slices.DeleteFunc(s.senders, func(sndr *memSender) bool { return sndr.LastSeen < cutoff })
+	return int64(before - len(s.senders)), nil
+}
+
+func (s *memStore) ReapMessagesOlderThan(ctx context.Context, cutoff int64) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.deleteMessagesLocked(func(msg message) bool { return msg.Timestamp < cutoff }), nil
+}
+
+// the helpers below expect s.mutex to be held
+
+// lobbyLocked builds a lobby around messages, which should already be
+// copies from lobbyMessagesLocked
+func (s *memStore) lobbyLocked(id string, messages []message) (lobbyData, error) {
+	stored, ok := s.lobbies[id]
+	if !ok {
+		return lobbyData{}, errLobbyNotFound
+	}
+
+	lobby := stored.info
+	lobby.Messages = s.withExtrasLocked(messages)
+	lobby.Senders = s.lobbySendersLocked(id)
+
+	pinned := []message{}
+	for _, msg := range s.lobbyMessagesLocked(id) {
+		if msg.Pinned {
+			pinned = append(pinned, msg)
+		}
+	}
+	lobby.PinnedMessages = s.withExtrasLocked(pinned)
+
+	return lobby, nil
+}
+
+// lobbyMessagesLocked returns copies, oldest first, so callers can change
+// them freely
+func (s *memStore) lobbyMessagesLocked(lobbyId string) []message {
+	messages := []message{}
+	for _, msg := range s.messages {
+		if msg.LobbyId == lobbyId {
+			msg.Mentions = slices.Clone(msg.Mentions)
+			msg.Attachments = slices.Clone(msg.Attachments)
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// withExtrasLocked fills in reaction counts, and makes sure attachments is
+// never nil, like attachReactions and loadAttachments do
+func (s *memStore) withExtrasLocked(messages []message) []message {
+	for i := range messages {
+		msg := &messages[i]
+
+		msg.Reactions = map[string]int{}
+		for _, r := range s.reactions {
+			if r.messageId == msg.Id {
+				msg.Reactions[r.emoji]++
+			}
+		}
+
+		if msg.Attachments == nil {
+			msg.Attachments = []attachment{}
+		}
+	}
+	return messages
+}
+
+func (s *memStore) messageLocked(id int) *message {
+	for i := range s.messages {
+		if s.messages[i].Id == id {
+			return &s.messages[i]
+		}
+	}
+	return nil
+}
+
+func (s *memStore) appendLocked(msg message) message {
+	s.lastId++
+	msg.Id = s.lastId
+	msg.Timestamp = time.Now().Unix()
+	msg.Version = 1
+	if msg.Type == "" {
+		msg.Type = MESSAGE_TYPE_USER
+	}
+
+	stored := msg
+	stored.Mentions = slices.Clone(msg.Mentions)
+	stored.Attachments = slices.Clone(msg.Attachments)
+	stored.Reactions = nil
+	s.messages = append(s.messages, stored)
+
+	if maxMessagesPerLobby > 0 {
+		s.trimLocked(msg.LobbyId, maxMessagesPerLobby)
+	}
+
+	return msg
+}
+
+func (s *memStore) trimLocked(lobbyId string, keep int) {
+	messages := s.lobbyMessagesLocked(lobbyId)
+	if len(messages) <= keep {
+		return
+	}
+
+	oldestKept := messages[len(messages)-keep].Id
+	s.deleteMessagesLocked(func(msg message) bool { return msg.LobbyId == lobbyId && msg.Id < oldestKept })
+}
+
+// deleteMessagesLocked is deleteMessagesWhere: the messages go along with
+// their reactions. it returns how many messages went
+func (s *memStore) deleteMessagesLocked(match func(message) bool) int64 {
+	deleted := map[int]bool{}
+	for _, msg := range s.messages {
+		if match(msg) {
+			deleted[msg.Id] = true
+		}
+	}
+
+	s.messages = slices.DeleteFunc(s.messages, func(msg message) bool { return deleted[msg.Id] })
+	s.reactions = slices.DeleteFunc(s.reactions, func(r memReaction) bool { return deleted[r.messageId] })
+	return int64(len(deleted))
+}
+
+func (s *memStore) senderLocked(lobbyId string, name string) *memSender {
+	for _, sndr := range s.senders {
+		if sndr.LobbyId == lobbyId && sndr.Username == name {
+			return sndr
+		}
+	}
+	return nil
+}
+
+// lobbySendersLocked returns copies with unread counts filled in, the same
+// way SENDER_SELECT works them out
+func (s *memStore) lobbySendersLocked(lobbyId string) []sender {
+	senders := []sender{}
+	for _, stored := range s.senders {
+		if stored.LobbyId != lobbyId {
+			continue
+		}
+
+		sndr := stored.sender
+		sndr.Color = clonePointer(sndr.Color)
+		sndr.AvatarUrl = clonePointer(sndr.AvatarUrl)
+		sndr.LastReadMessageId = clonePointer(sndr.LastReadMessageId)
+
+		lastRead := 0
+		if sndr.LastReadMessageId != nil {
+			lastRead = *sndr.LastReadMessageId
+		}
+
+		sndr.UnreadCount = 0
+		for _, msg := range s.messages {
+			if msg.LobbyId == lobbyId && msg.Id > lastRead && msg.SenderName != sndr.Username && !msg.Deleted {
+				sndr.UnreadCount++
+			}
+		}
+
+		senders = append(senders, sndr)
+	}
+	return senders
+}
+
+// lastActiveLocked is LOBBY_LAST_ACTIVE for one lobby
+func (s *memStore) lastActiveLocked(id string) int64 {
+	lobby := s.lobbies[id]
+
+	lastActive := max(lobby.info.CreatedAt, lobby.restoredAt)
+	for _, msg := range s.messages {
+		if msg.LobbyId == id {
+			lastActive = max(lastActive, msg.Timestamp)
+		}
+	}
+	return lastActive
+}
+
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+
+	v := *p
+	return &v
+}
+
+var _ Store = (*memStore)(nil)
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mentionList is stored as a JSON array in message.mentions
+type mentionList []string
+
+func (m *mentionList) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("scan mentions: unexpected %T", src)
+	}
+}
+
+func (m mentionList) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal([]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// isNameRune is what can continue a name, so "@bob" doesn't match in "@bobby"
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+// parseMentions finds the senders in the lobby that content @-mentions. names
+// can contain spaces, so instead of tokenizing we look for each sender's name
+func parseMentions(content string, senders []sender) mentionList {
+	var mentions mentionList
+
+	for _, sndr := range senders {
+		if sndr.Username != "" && mentionsName(content, sndr.Username) {
+			mentions = append(mentions, sndr.Username)
+		}
+	}
+
+	return mentions
+}
+
+func mentionsName(content string, name string) bool {
+	needle := "@" + name
+
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], needle)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(needle)
+
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+
+		// an email address or a longer name isn't a mention
+		if (start == 0 || !isNameRune(before)) && (end == len(content) || !isNameRune(after)) {
+			return true
+		}
+
+		offset = start + 1
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	messagesInserted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_inserted_total",
+		Help: "Messages successfully written to the database.",
+	})
+
+	dbErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_db_errors_total",
+		Help: "Database errors returned to clients or hit by background jobs.",
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "chat_active_lobbies",
+		Help: "Lobbies currently in the database.",
+	}, countLobbiesForMetrics)
+)
+
+// countLobbiesForMetrics runs on every scrape, so it gets its own short timeout
+func countLobbiesForMetrics() float64 {
+	if db == nil {
+		return math.NaN()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	count, err := store.CountLobbies(ctx)
+	if err != nil {
+		dbErrors.Inc()
+		return math.NaN()
+	}
+
+	return float64(count)
+}
+
+// instrumentRequests records count and latency for every route, keyed by the
+// route pattern rather than the raw path so ids don't explode the label set
+func instrumentRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpLatency.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
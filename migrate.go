@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// named lock so replicas starting together apply migrations one at a time
+const MIGRATION_LOCK_NAME = "chat_schema_migrations"
+const MIGRATION_LOCK_TIMEOUT_SECONDS = 60
+const MIGRATION_TIMEOUT = 5 * time.Minute
+
+// MySQL errors meaning a statement's change is already there: table exists,
+// duplicate column, duplicate key name
+var alreadyAppliedErrors = []uint16{1050, 1060, 1061}
+
+// alreadyApplied lets a migration that stopped partway be run again, since
+// MySQL has no ADD COLUMN IF NOT EXISTS
+func alreadyApplied(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && slices.Contains(alreadyAppliedErrors, mysqlErr.Number)
+}
+
+// runMigrations applies every file in migrations/ that isn't recorded in
+// schema_migrations yet, in filename order
+func runMigrations() error {
+	ctx, cancel := context.WithTimeout(context.Background(), MIGRATION_TIMEOUT)
+	defer cancel()
+
+	// GET_LOCK belongs to the connection, so everything has to run on this one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", MIGRATION_LOCK_NAME, MIGRATION_LOCK_TIMEOUT_SECONDS).Scan(&locked); err != nil {
+		return fmt.Errorf("migrate: take lock: %w", err)
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("migrate: timed out waiting for another instance's migrations")
+	}
+	defer conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", MIGRATION_LOCK_NAME)
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version VARCHAR(255) NOT NULL PRIMARY KEY, appliedAt BIGINT NOT NULL)"); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		if applied[version] {
+			continue
+		}
+
+		contents, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", version, err)
+		}
+
+		// MySQL commits DDL as it goes, so there's no transaction to roll back.
+		// instead each statement should make one change (one ADD COLUMN per
+		// ALTER), and ones that find their change already made are skipped
+		for _, statement := range splitStatements(string(contents)) {
+			if _, err := conn.ExecContext(ctx, statement); err != nil && !alreadyApplied(err) {
+				return fmt.Errorf("migrate %s: %w", version, err)
+			}
+		}
+
+		if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, appliedAt) VALUES (?, ?)", version, time.Now().Unix()); err != nil {
+			return fmt.Errorf("migrate %s: %w", version, err)
+		}
+
+		slog.Info("applied migration", "version", version)
+	}
+
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[string]bool, error) {
+	applied := map[string]bool{}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+		applied[version] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return applied, nil
+}
+
+// splitStatements drops "--" comment lines and splits on ";", since the
+// driver runs one statement per Exec. so no semicolons inside string literals
+func splitStatements(contents string) []string {
+	var kept []string
+	for _, line := range strings.Split(contents, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			kept = append(kept, line)
+		}
+	}
+
+	statements := []string{}
+	for _, statement := range strings.Split(strings.Join(kept, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
@@ -0,0 +1,72 @@
+-- Tables the server expects in the `chat` database (or whatever DBNAME is). Use utf8mb4 so emoji fit:
+-- CREATE DATABASE chat CHARACTER SET utf8mb4;
+--
+-- Applied on startup by runMigrations. Databases set up by hand before
+-- migrations existed should apply the `upgrading:` statements below first,
+-- since CREATE TABLE IF NOT EXISTS leaves existing tables alone.
+-- Later changes go in new numbered files, never edits to this one.
+
+CREATE TABLE IF NOT EXISTS lobbies (
+	id VARCHAR(32) NOT NULL PRIMARY KEY,
+	-- upgrading: ALTER TABLE lobbies ADD COLUMN createdAt BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP());
+	createdAt BIGINT NOT NULL,
+	-- upgrading: ALTER TABLE lobbies ADD COLUMN passwordHash CHAR(60) NULL;
+	passwordHash CHAR(60) NULL,
+	-- upgrading: ALTER TABLE lobbies ADD COLUMN name VARCHAR(64) NULL;
+	name VARCHAR(64) NULL,
+	-- upgrading: ALTER TABLE lobbies ADD COLUMN slowModeSeconds INT NOT NULL DEFAULT 0, ADD COLUMN readOnly BOOLEAN NOT NULL DEFAULT FALSE;
+	slowModeSeconds INT NOT NULL DEFAULT 0,
+	readOnly BOOLEAN NOT NULL DEFAULT FALSE,
+	-- upgrading: ALTER TABLE lobbies ADD COLUMN systemMessages BOOLEAN NOT NULL DEFAULT FALSE;
+	systemMessages BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS message (
+	id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	lobbyId VARCHAR(32) NOT NULL,
+	senderName VARCHAR(32) NOT NULL,
+	-- upgrading: ALTER TABLE message MODIFY messageString TEXT NOT NULL;
+	-- (TEXT since encrypted content is longer than the message itself)
+	messageString TEXT NOT NULL,
+	timestamp BIGINT NOT NULL,
+	-- upgrading: ALTER TABLE message ADD COLUMN editedAt BIGINT NULL;
+	editedAt BIGINT NULL,
+	-- upgrading: ALTER TABLE message ADD COLUMN replyToId INT NULL;
+	replyToId INT NULL,
+	-- upgrading: ALTER TABLE message ADD COLUMN mentions JSON NULL;
+	mentions JSON NULL,
+	-- upgrading: ALTER TABLE message ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;
+	deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	-- upgrading: ALTER TABLE message ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+	pinned BOOLEAN NOT NULL DEFAULT FALSE,
+	-- upgrading: ALTER TABLE message ADD COLUMN version INT NOT NULL DEFAULT 1;
+	version INT NOT NULL DEFAULT 1,
+	-- upgrading: ALTER TABLE message ADD COLUMN clientMessageId VARCHAR(64) NULL;
+	clientMessageId VARCHAR(64) NULL,
+	-- upgrading: ALTER TABLE message ADD COLUMN type VARCHAR(16) NOT NULL DEFAULT 'user';
+	type VARCHAR(16) NOT NULL DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS sender (
+	name VARCHAR(32) NOT NULL,
+	lobbyId VARCHAR(32) NOT NULL,
+	isTyping BOOLEAN NOT NULL DEFAULT FALSE,
+	-- upgrading: ALTER TABLE sender ADD COLUMN lastSeen BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP());
+	lastSeen BIGINT NOT NULL,
+	-- upgrading: ALTER TABLE sender ADD COLUMN color CHAR(7) NULL, ADD COLUMN avatarUrl VARCHAR(512) NULL;
+	color CHAR(7) NULL,
+	avatarUrl VARCHAR(512) NULL,
+	-- upgrading: ALTER TABLE sender ADD COLUMN sessionTokenHash CHAR(64) NULL;
+	sessionTokenHash CHAR(64) NULL,
+	-- upgrading: ALTER TABLE sender ADD COLUMN lastReadMessageId INT NULL;
+	lastReadMessageId INT NULL,
+	-- upgrading: remove any duplicate rows, then ALTER TABLE sender ADD UNIQUE KEY senderName (name, lobbyId);
+	UNIQUE KEY senderName (name, lobbyId)
+);
+
+CREATE TABLE IF NOT EXISTS reactions (
+	messageId INT NOT NULL,
+	emoji VARCHAR(64) CHARACTER SET utf8mb4 NOT NULL,
+	senderName VARCHAR(32) NOT NULL,
+	PRIMARY KEY (messageId, emoji, senderName)
+);
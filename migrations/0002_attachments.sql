@@ -0,0 +1,9 @@
+-- links to files hosted elsewhere, shown with the message they were posted in
+CREATE TABLE IF NOT EXISTS attachments (
+	id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	messageId INT NOT NULL,
+	url VARCHAR(2048) NOT NULL,
+	mimeType VARCHAR(127) NOT NULL,
+	sizeBytes BIGINT NULL,
+	INDEX attachmentsMessage (messageId)
+);
@@ -0,0 +1,5 @@
+-- archived lobbies can still be read but take no new messages or joins.
+-- one column per statement, so a half-applied run can be picked up again
+ALTER TABLE lobbies ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE lobbies ADD COLUMN archivedAt BIGINT NULL;
+ALTER TABLE lobbies ADD COLUMN restoredAt BIGINT NULL;
@@ -0,0 +1,3 @@
+-- who created each lobby, for MAX_LOBBIES_PER_IP
+ALTER TABLE lobbies ADD COLUMN creatorIp VARCHAR(45) NULL;
+CREATE INDEX lobbiesCreatorIp ON lobbies (creatorIp);
@@ -0,0 +1,2 @@
+-- nearly every message query is per lobby, ordered or paged by id
+CREATE INDEX messageLobby ON message (lobbyId, id);
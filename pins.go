@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_PINS_PER_LOBBY = 5
+
+type pinRequest struct {
+	SenderName string `json:"senderName"`
+}
+
+// getPinnedMessages returns every pinned message in the lobby, oldest first,
+// with reactions and attachments filled in
+func getPinnedMessages(ctx context.Context, q querier, lobbyId string) ([]message, error) {
+	messages := []message{}
+
+	rows, err := q.QueryContext(ctx, "SELECT "+MESSAGE_COLUMNS+" FROM message WHERE lobbyId = ? AND pinned ORDER BY id ASC", lobbyId)
+	if err != nil {
+		return nil, fmt.Errorf("get pins for %q: %w", lobbyId, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg message
+		if err := scanMessage(rows, &msg); err != nil {
+			return nil, fmt.Errorf("get pins for %q: %w", lobbyId, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get pins for %q: %w", lobbyId, err)
+	}
+
+	if err := attachReactions(ctx, q, lobbyId, messages); err != nil {
+		return nil, err
+	}
+
+	if err := loadAttachments(ctx, q, lobbyId, messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func countPins(ctx context.Context, lobbyId string) (int, error) {
+	var count int
+
+	row := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM message WHERE lobbyId = ? AND pinned", lobbyId)
+	if err := row.Scan(&count); err != nil {
+		return 0, fmt.Errorf("count pins for %q: %w", lobbyId, err)
+	}
+
+	return count, nil
+}
+
+func setPinned(ctx context.Context, id int, pinned bool) error {
+	_, err := db.ExecContext(ctx, "UPDATE message SET pinned = ? WHERE id = ?", pinned, id)
+	if err != nil {
+		return fmt.Errorf("pin message %d: %w", id, err)
+	}
+	return nil
+}
+
+// bindPin loads the message being (un)pinned and checks the caller is its
+// author or an admin. admins can leave the body out
+func bindPin(ctx context.Context, c *gin.Context) (message, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_MESSAGE_NOT_FOUND, "message": "Message not found!"})
+		return message{}, false
+	}
+
+	var request pinRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return message{}, false
+	}
+
+	request.SenderName = authedName(c, request.SenderName)
+
+	original, err := store.GetMessage(ctx, id)
+	if errors.Is(err, errMessageNotFound) || (err == nil && original.Deleted) {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_MESSAGE_NOT_FOUND, "message": "Message not found!"})
+		return message{}, false
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return message{}, false
+	}
+
+	if !isAdmin(c) && (request.SenderName == "" || original.SenderName != request.SenderName) {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_NOT_AUTHOR, "message": "Only the author or an admin can pin a message!"})
+		return message{}, false
+	}
+
+	return original, true
+}
+
+func pinMessage(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	original, ok := bindPin(ctx, c)
+	if !ok {
+		return
+	}
+
+	if !original.Pinned {
+		count, err := store.CountPins(ctx, original.LobbyId)
+		if err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			return
+		}
+
+		if count >= MAX_PINS_PER_LOBBY {
+			c.JSON(http.StatusConflict, gin.H{"code": ERR_TOO_MANY_PINS, "message": "This lobby already has the most pins allowed!", "maxPins": MAX_PINS_PER_LOBBY})
+			return
+		}
+
+		if err := store.SetPinned(ctx, original.Id, true); err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := store.GetLobby(ctx, original.LobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
+
+func unpinMessage(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	original, ok := bindPin(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := store.SetPinned(ctx, original.Id, false); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	result, err := store.GetLobby(ctx, original.LobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// forget an IP once it's gone this long without a request
+const RATE_LIMIT_IDLE_TIMEOUT = 10 * time.Minute
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter hands out a token bucket per client IP
+type ipRateLimiter struct {
+	mutex    sync.Mutex
+	visitors map[string]*visitor
+	limit    rate.Limit
+	burst    int
+}
+
+func newIPRateLimiter(limit rate.Limit, burst int) *ipRateLimiter {
+	limiter := &ipRateLimiter{visitors: map[string]*visitor{}, limit: limit, burst: burst}
+	go limiter.cleanup()
+	return limiter
+}
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	v, ok := l.visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.visitors[ip] = v
+	}
+	v.lastSeen = time.Now()
+
+	return v.limiter.Allow()
+}
+
+func (l *ipRateLimiter) cleanup() {
+	ticker := time.NewTicker(RATE_LIMIT_IDLE_TIMEOUT)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.mutex.Lock()
+		for ip, v := range l.visitors {
+			if time.Since(v.lastSeen) > RATE_LIMIT_IDLE_TIMEOUT {
+				delete(l.visitors, ip)
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+// middleware rejects requests with 429 once the client's bucket runs dry
+func (l *ipRateLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.allow(c.ClientIP()) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": ERR_RATE_LIMITED, "message": "Too many requests, slow down!"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// senderFloodGuard caps how many messages one name can post to a lobby within
+// a sliding window, regardless of which IPs they come from
+type senderFloodGuard struct {
+	mutex  sync.Mutex
+	recent map[string][]time.Time
+	max    int
+	window time.Duration
+}
+
+func newSenderFloodGuard(max int, window time.Duration) *senderFloodGuard {
+	guard := &senderFloodGuard{recent: map[string][]time.Time{}, max: max, window: window}
+	go guard.cleanup()
+	return guard
+}
+
+// allow records a post by name in the lobby if it's under the limit
+func (g *senderFloodGuard) allow(lobbyId string, name string) bool {
+	if g.max <= 0 {
+		return true
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	key := lobbyId + "\x00" + name
+	now := time.Now()
+
+	kept := g.recent[key][:0]
+	for _, at := range g.recent[key] {
+		if now.Sub(at) < g.window {
+			kept = append(kept, at)
+		}
+	}
+
+	if len(kept) >= g.max {
+		g.recent[key] = kept
+		return false
+	}
+
+	g.recent[key] = append(kept, now)
+	return true
+}
+
+func (g *senderFloodGuard) cleanup() {
+	ticker := time.NewTicker(RATE_LIMIT_IDLE_TIMEOUT)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.mutex.Lock()
+		for key, times := range g.recent {
+			if len(times) == 0 || time.Since(times[len(times)-1]) > g.window {
+				delete(g.recent, key)
+			}
+		}
+		g.mutex.Unlock()
+	}
+}
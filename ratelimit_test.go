@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postFrom posts an empty message, which the limiter still counts, from
+// httptest's address with a made up X-Forwarded-For
+func postFrom(t *testing.T, router http.Handler, forwardedFor string) int {
+	t.Helper()
+
+	req := newRequest(t, http.MethodPost, "/postMessage", gin.H{"lobbyId": "lobby", "senderName": "alice", "messageContent": ""})
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	return serve(router, req).Code
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	useMemStore(t)
+	t.Setenv("MESSAGE_RATE_PER_SECOND", "1")
+	t.Setenv("MESSAGE_RATE_BURST", "1")
+	router := newRouter()
+
+	postFrom(t, router, "203.0.113.1")
+	if status := postFrom(t, router, "203.0.113.2"); status != http.StatusTooManyRequests {
+		t.Errorf("got status %d with a new X-Forwarded-For, want 429", status)
+	}
+}
+
+func TestRateLimitUsesForwardedForFromTrustedProxies(t *testing.T) {
+	useMemStore(t)
+	t.Setenv("MESSAGE_RATE_PER_SECOND", "1")
+	t.Setenv("MESSAGE_RATE_BURST", "1")
+	// where httptest requests come from
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.1")
+	router := newRouter()
+
+	postFrom(t, router, "203.0.113.1")
+	if status := postFrom(t, router, "203.0.113.2"); status == http.StatusTooManyRequests {
+		t.Error("a second client behind the proxy shared the first one's bucket")
+	}
+	if status := postFrom(t, router, "203.0.113.1"); status != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the first client again, want 429", status)
+	}
+}
+
+func createLobbyFrom(t *testing.T, router http.Handler, forwardedFor string) int {
+	t.Helper()
+
+	req := newRequest(t, http.MethodPost, "/createLobby", nil)
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	return serve(router, req).Code
+}
+
+func TestLobbyCapIgnoresSpoofedForwardedFor(t *testing.T) {
+	useMemStore(t)
+	saved := maxLobbiesPerIp
+	maxLobbiesPerIp = 2
+	t.Cleanup(func() { maxLobbiesPerIp = saved })
+	router := newRouter()
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		if status := createLobbyFrom(t, router, ip); status != http.StatusCreated {
+			t.Fatalf("got status %d creating a lobby, want 201", status)
+		}
+	}
+
+	req := newRequest(t, http.MethodPost, "/createLobby", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.3")
+	w := serve(router, req)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if code := decodeBody[map[string]any](t, w)["code"]; code != ERR_TOO_MANY_LOBBIES {
+		t.Errorf("got code %v with a new X-Forwarded-For, want %s", code, ERR_TOO_MANY_LOBBIES)
+	}
+}
+
+func TestLobbyCreatorIpIgnoresSpoofedForwardedFor(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+
+	req := newRequest(t, http.MethodPost, "/createLobby", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	w := serve(router, req)
+	expectStatus(t, w, http.StatusCreated)
+	id := decodeBody[string](t, w)
+
+	mem.mutex.Lock()
+	creatorIp := mem.lobbies[id].creatorIp
+	mem.mutex.Unlock()
+
+	if creatorIp != "192.0.2.1" {
+		t.Errorf("stored creator ip %q, want the connection's address", creatorIp)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// long enough for ZWJ sequences like family emoji
+const MAX_EMOJI_LEN = 16
+
+type reactionRequest struct {
+	SenderName string `json:"senderName"`
+	Emoji      string `json:"emoji"`
+}
+
+// attachReactions fills in per-emoji reaction counts for messages in a lobby
+func attachReactions(ctx context.Context, q querier, lobbyId string, messages []message) error {
+	byId := map[int]*message{}
+	for i := range messages {
+		messages[i].Reactions = map[string]int{}
+		byId[messages[i].Id] = &messages[i]
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT reactions.messageId, reactions.emoji, COUNT(*) FROM reactions
+		JOIN message ON message.id = reactions.messageId
+		WHERE message.lobbyId = ?
+		GROUP BY reactions.messageId, reactions.emoji`, lobbyId)
+	if err != nil {
+		return fmt.Errorf("get reactions for %q: %w", lobbyId, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId, count int
+		var emoji string
+		if err := rows.Scan(&messageId, &emoji, &count); err != nil {
+			return fmt.Errorf("get reactions for %q: %w", lobbyId, err)
+		}
+
+		// a paged fetch only holds some of the lobby's messages
+		if msg, ok := byId[messageId]; ok {
+			msg.Reactions[emoji] = count
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("get reactions for %q: %w", lobbyId, err)
+	}
+
+	return nil
+}
+
+// addReaction reports false if the sender already reacted with that emoji
+func addReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error) {
+	result, err := db.ExecContext(ctx, "INSERT IGNORE INTO reactions (messageId, emoji, senderName) VALUES (?, ?, ?)", messageId, emoji, senderName)
+	if err != nil {
+		return false, fmt.Errorf("add reaction: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("add reaction: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// removeReaction reports false if there was no such reaction
+func removeReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM reactions WHERE messageId = ? AND emoji = ? AND senderName = ?", messageId, emoji, senderName)
+	if err != nil {
+		return false, fmt.Errorf("remove reaction: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("remove reaction: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// bindReaction parses and validates a react/unreact request, writing the
+// error response itself when it returns false
+func bindReaction(c *gin.Context) (int, reactionRequest, bool) {
+	var request reactionRequest
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_MESSAGE_NOT_FOUND, "message": "Message not found!"})
+		return 0, request, false
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return 0, request, false
+	}
+
+	request.SenderName = authedName(c, request.SenderName)
+	if strings.TrimSpace(request.SenderName) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_USERNAME_EMPTY, "message": "Username is empty!"})
+		return 0, request, false
+	}
+
+	request.Emoji = strings.TrimSpace(request.Emoji)
+	if request.Emoji == "" || utf8.RuneCountInString(request.Emoji) > MAX_EMOJI_LEN {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_EMOJI, "message": "Emoji is empty or too long!"})
+		return 0, request, false
+	}
+
+	return id, request, true
+}
+
+// requireReactionSender checks the reacting sender is in the message's lobby,
+// and for private lobbies that they hold its session token. it writes the error response itself when it returns false
+func requireReactionSender(ctx context.Context, c *gin.Context, lobbyId string, name string) bool {
+	if !checkLobbyMember(ctx, c, lobbyId, name) {
+		return false
+	}
+
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	if exists, err := store.SenderExists(ctx, lobbyId, name); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return false
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_SENDER_NOT_FOUND, "message": "Sender is not in that lobby!"})
+		return false
+	}
+
+	return true
+}
+
+func reactToMessage(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, request, ok := bindReaction(c)
+	if !ok {
+		return
+	}
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	original, err := store.GetMessage(ctx, id)
+	if errors.Is(err, errMessageNotFound) || (err == nil && original.Deleted) {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_MESSAGE_NOT_FOUND, "message": "Message not found!"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !requireReactionSender(ctx, c, original.LobbyId, request.SenderName) {
+		return
+	}
+
+	added, err := store.AddReaction(ctx, id, request.SenderName, request.Emoji)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !added {
+		c.JSON(http.StatusConflict, gin.H{"code": ERR_ALREADY_REACTED, "message": "Already reacted with that emoji!"})
+		return
+	}
+
+	result, err := store.GetLobby(ctx, original.LobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
+
+func unreactToMessage(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, request, ok := bindReaction(c)
+	if !ok {
+		return
+	}
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	original, err := store.GetMessage(ctx, id)
+	if errors.Is(err, errMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_MESSAGE_NOT_FOUND, "message": "Message not found!"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !requireReactionSender(ctx, c, original.LobbyId, request.SenderName) {
+		return
+	}
+
+	removed, err := store.RemoveReaction(ctx, id, request.SenderName, request.Emoji)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_REACTION_NOT_FOUND, "message": "No such reaction!"})
+		return
+	}
+
+	result, err := store.GetLobby(ctx, original.LobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const LOBBY_REAP_INTERVAL = 10 * time.Minute
+const SENDER_REAP_INTERVAL = time.Minute
+
+// when a lobby was last active: created, restored from the archive, or
+// posted in. for queries grouping lobbies joined with their messages
+const LOBBY_LAST_ACTIVE = "GREATEST(lobbies.createdAt, COALESCE(lobbies.restoredAt, 0), COALESCE(MAX(message.timestamp), 0))"
+const DEFAULT_MESSAGE_RETENTION_INTERVAL_MINUTES = 60
+
+// reapIdleLobbies deletes lobbies whose newest message (or creation, if they
+// never got one) is older than ttl, along with their messages and senders
+func reapIdleLobbies(ttl time.Duration) {
+	ticker := time.NewTicker(LOBBY_REAP_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reaped, err := reapLobbiesIdleSince(time.Now().Add(-ttl).Unix())
+		if err != nil {
+			dbErrors.Inc()
+			slog.Error("reaping idle lobbies", "error", err)
+			continue
+		}
+
+		if reaped > 0 {
+			slog.Info("reaped idle lobbies", "count", reaped)
+		}
+	}
+}
+
+func reapLobbiesIdleSince(cutoff int64) (int, error) {
+	// hold every lock so nobody posts into or joins a lobby halfway through deleting it
+	lobbyMutex.Lock()
+	defer lobbyMutex.Unlock()
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	return store.ReapLobbiesIdleSince(ctx, cutoff)
+}
+
+func (mysqlStore) ReapLobbiesIdleSince(ctx context.Context, cutoff int64) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("reap lobbies: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT lobbies.id FROM lobbies
+		LEFT JOIN message ON message.lobbyId = lobbies.id
+		GROUP BY lobbies.id, lobbies.createdAt, lobbies.restoredAt
+		HAVING `+LOBBY_LAST_ACTIVE+` < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("reap lobbies: %w", err)
+	}
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("reap lobbies: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("reap lobbies: %w", err)
+	}
+
+	for _, id := range ids {
+		if _, err := deleteMessagesWhere(ctx, tx, "message.lobbyId = ?", id); err != nil {
+			return 0, fmt.Errorf("reap lobby %q: %w", id, err)
+		}
+
+		for _, query := range []string{
+			"DELETE FROM sender WHERE lobbyId = ?",
+			"DELETE FROM lobbies WHERE id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return 0, fmt.Errorf("reap lobby %q: %w", id, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("reap lobbies: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+// archiveIdleLobbies archives lobbies that have been idle for longer than
+// after. they stay readable, and the lobby reaper deletes them later if
+// LOBBY_TTL_HOURS is set
+func archiveIdleLobbies(after time.Duration) {
+	ticker := time.NewTicker(LOBBY_REAP_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		archived, err := archiveLobbiesIdleSince(time.Now().Add(-after).Unix())
+		if err != nil {
+			dbErrors.Inc()
+			slog.Error("archiving idle lobbies", "error", err)
+			continue
+		}
+
+		if archived > 0 {
+			slog.Info("archived idle lobbies", "count", archived)
+		}
+	}
+}
+
+func archiveLobbiesIdleSince(cutoff int64) (int64, error) {
+	lobbyMutex.Lock()
+	defer lobbyMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	return store.ArchiveLobbiesIdleSince(ctx, cutoff)
+}
+
+func (mysqlStore) ArchiveLobbiesIdleSince(ctx context.Context, cutoff int64) (int64, error) {
+	// MySQL won't update a table it's selecting from unless the select is
+	// wrapped in a derived table
+	result, err := db.ExecContext(ctx, `
+		UPDATE lobbies SET archived = TRUE, archivedAt = ?
+		WHERE NOT archived AND id IN (SELECT id FROM (
+			SELECT lobbies.id FROM lobbies
+			LEFT JOIN message ON message.lobbyId = lobbies.id
+			GROUP BY lobbies.id, lobbies.createdAt, lobbies.restoredAt
+			HAVING `+LOBBY_LAST_ACTIVE+` < ?
+		) AS idle)`, time.Now().Unix(), cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("archive lobbies: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// reapIdleSenders removes senders whose lastSeen is older than timeout
+func reapIdleSenders(timeout time.Duration) {
+	ticker := time.NewTicker(SENDER_REAP_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reaped, err := reapSendersIdleSince(time.Now().Add(-timeout).Unix())
+		if err != nil {
+			dbErrors.Inc()
+			slog.Error("reaping idle senders", "error", err)
+			continue
+		}
+
+		if reaped > 0 {
+			slog.Info("reaped idle senders", "count", reaped)
+		}
+	}
+}
+
+func reapSendersIdleSince(cutoff int64) (int64, error) {
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	return store.ReapSendersIdleSince(ctx, cutoff)
+}
+
+func (mysqlStore) ReapSendersIdleSince(ctx context.Context, cutoff int64) (int64, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM sender WHERE lastSeen < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("reap senders: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// reapOldMessages deletes messages (with their reactions and attachments)
+// older than retention every interval. it only touches messages, so lobbies
+// emptied by it are left for the lobby reaper to judge by their createdAt
+// like any other quiet lobby
+func reapOldMessages(retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reaped, err := reapMessagesOlderThan(time.Now().Add(-retention).Unix())
+		if err != nil {
+			dbErrors.Inc()
+			slog.Error("reaping old messages", "error", err)
+			continue
+		}
+
+		slog.Info("reaped old messages", "count", reaped)
+	}
+}
+
+func reapMessagesOlderThan(cutoff int64) (int64, error) {
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	return store.ReapMessagesOlderThan(ctx, cutoff)
+}
+
+func (mysqlStore) ReapMessagesOlderThan(ctx context.Context, cutoff int64) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("reap messages: %w", err)
+	}
+	defer tx.Rollback()
+
+	reaped, err := deleteMessagesWhere(ctx, tx, "message.timestamp < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("reap messages: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("reap messages: %w", err)
+	}
+
+	return reaped, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type markReadRequest struct {
+	Name              string `json:"name"`
+	LastReadMessageId int    `json:"lastReadMessageId"`
+}
+
+// setLastRead only ever moves the position forward, so a stale request from
+// another tab can't bring old messages back as unread
+func setLastRead(ctx context.Context, lobbyId string, name string, messageId int) error {
+	_, err := db.ExecContext(ctx, "UPDATE sender SET lastReadMessageId = GREATEST(COALESCE(lastReadMessageId, 0), ?) WHERE lobbyId = ? AND name = ?", messageId, lobbyId, name)
+	if err != nil {
+		return fmt.Errorf("mark read for %q in %q: %w", name, lobbyId, err)
+	}
+	return nil
+}
+
+func markRead(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	lobbyId := c.Param("id")
+
+	var request markReadRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return
+	}
+
+	request.Name = authedName(c, request.Name)
+
+	if !checkLobbyMember(ctx, c, lobbyId, request.Name) {
+		return
+	}
+
+	read, err := store.GetMessage(ctx, request.LastReadMessageId)
+	if errors.Is(err, errMessageNotFound) || (err == nil && read.LobbyId != lobbyId) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_MESSAGE_NOT_IN_LOBBY, "message": "Message is not in this lobby!"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	if exists, err := store.SenderExists(ctx, lobbyId, request.Name); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_SENDER_NOT_FOUND, "message": "Sender is not in that lobby!"})
+		return
+	}
+
+	if err := store.SetLastRead(ctx, lobbyId, request.Name, request.LastReadMessageId); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	result, err := store.GetLobby(ctx, lobbyId)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errSenderNotFound = errors.New("sender not found")
+
+// setSenderName renames a sender along with their messages and reactions in
+// the lobby, so their history follows them. callers should hold msgMutex and
+// senderMutex
+func setSenderName(ctx context.Context, lobbyId string, from string, to string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+	defer tx.Rollback()
+
+	var taken int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sender WHERE lobbyId = ? AND name = ?", lobbyId, to).Scan(&taken); err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+	if taken > 0 {
+		return errUsernameTaken
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE sender SET name = ? WHERE lobbyId = ? AND name = ?", to, lobbyId, from)
+	if err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+	if affected == 0 {
+		return errSenderNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE message SET senderName = ? WHERE lobbyId = ? AND senderName = ? AND type = ?", to, lobbyId, from, MESSAGE_TYPE_USER); err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+
+	// someone who used the new name before and left may have reacted to the
+	// same messages, so skip those and drop what's left over
+	if _, err := tx.ExecContext(ctx, "UPDATE IGNORE reactions JOIN message ON reactions.messageId = message.id SET reactions.senderName = ? WHERE message.lobbyId = ? AND reactions.senderName = ?", to, lobbyId, from); err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE reactions FROM reactions JOIN message ON reactions.messageId = message.id WHERE message.lobbyId = ? AND reactions.senderName = ?", lobbyId, from); err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("rename %q in %q: %w", from, lobbyId, err)
+	}
+	return nil
+}
+
+// renameSender changes a sender's display name mid-session. with
+// AUTH_JWT_SECRET set the token decides who you are, so only admins can
+// rename anyone. without it, you need the sender's session token
+func renameSender(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+	from := c.Param("name")
+
+	if jwtSecret != nil && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_ADMIN_REQUIRED, "message": "Names come from your token, only admins can rename senders!"})
+		return
+	}
+
+	var request struct {
+		Name         string `json:"name"`
+		SessionToken string `json:"sessionToken"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return
+	}
+
+	if !isAdmin(c) {
+		if owner, err := ownsSession(ctx, id, from, request.SessionToken); err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			return
+		} else if !owner {
+			c.JSON(http.StatusForbidden, gin.H{"code": ERR_INVALID_SESSION, "message": "Only that sender can change their name!"})
+			return
+		}
+	}
+
+	to := strings.TrimSpace(request.Name)
+	if to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_USERNAME_EMPTY, "message": "Username is empty!"})
+		return
+	}
+
+	if length := utf8.RuneCountInString(to); length > maxUsernameLen {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_USERNAME_TOO_LONG, "message": "Username is too long!", "maxLength": maxUsernameLen, "actualLength": length})
+		return
+	}
+
+	if isReservedName(to) {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_USERNAME_RESERVED, "message": "That name is reserved!"})
+		return
+	}
+
+	msgMutex.Lock()
+	defer msgMutex.Unlock()
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+
+	err := store.RenameSender(ctx, id, from, to)
+	if errors.Is(err, errUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"code": ERR_USERNAME_TAKEN, "message": "Username taken!"})
+		return
+	} else if errors.Is(err, errSenderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_SENDER_NOT_FOUND, "message": "Sender is not in that lobby!"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	forgetTyping(senderKey{LobbyId: id, Name: from})
+	renameSubscribers(id, from, to)
+	broadcast(id, gin.H{"type": "renamed", "from": from, "to": to})
+	postSystemMessage(ctx, id, from+" is now "+to)
+
+	result, err := store.GetLobby(ctx, id)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenameSenderNeedsTheirSession(t *testing.T) {
+	mem := useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	aliceToken := enterTestLobby(t, router, id, "alice")
+	bobToken := enterTestLobby(t, router, id, "bob")
+	path := "/lobby/" + id + "/sender/alice"
+
+	for name, token := range map[string]string{"no token": "", "someone else's token": bobToken, "a made up token": "nope"} {
+		w := doRequest(t, router, http.MethodPut, path, gin.H{"name": "mallory", "sessionToken": token})
+		if w.Code != http.StatusForbidden {
+			t.Errorf("with %s: got status %d, want 403", name, w.Code)
+		}
+	}
+
+	if exists, _ := mem.SenderExists(context.Background(), id, "alice"); !exists {
+		t.Fatal("alice was renamed without her session token")
+	}
+
+	w := doRequest(t, router, http.MethodPut, path, gin.H{"name": "alicia", "sessionToken": aliceToken})
+	expectStatus(t, w, http.StatusOK)
+
+	if exists, _ := mem.SenderExists(context.Background(), id, "alicia"); !exists {
+		t.Error("alice was not renamed with her own session token")
+	}
+}
+
+func TestAdminCanRenameAnySender(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+	t.Setenv("ADMIN_TOKEN", "secret")
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+
+	req := newRequest(t, http.MethodPut, "/lobby/"+id+"/sender/alice", gin.H{"name": "alicia"})
+	req.Header.Set("Authorization", "Bearer secret")
+	expectStatus(t, serve(router, req), http.StatusOK)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const SESSION_TOKEN_BYTES = 32
+
+// SESSION_TOKEN_HEADER carries the session token on requests that don't have
+// a body to put it in. websockets and EventSource can't set headers, so
+// ?sessionToken= works too
+const SESSION_TOKEN_HEADER = "X-Session-Token"
+
+// newSessionToken is handed to a sender when they first enter, and is what
+// lets them take their name back after a reconnect. only its hash is stored
+func newSessionToken() string {
+	b := make([]byte, SESSION_TOKEN_BYTES)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %v", err))
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// getSessionTokenHash returns nil for senders that joined before tokens existed
+func getSessionTokenHash(ctx context.Context, lobbyId string, name string) (*string, error) {
+	var tokenHash *string
+
+	row := db.QueryRowContext(ctx, "SELECT sessionTokenHash FROM sender WHERE lobbyId = ? AND name = ?", lobbyId, name)
+	if err := row.Scan(&tokenHash); errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get session for %q in %q: %w", name, lobbyId, err)
+	}
+
+	return tokenHash, nil
+}
+
+func sessionTokenMatches(storedHash *string, token string) bool {
+	if storedHash == nil || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(*storedHash), []byte(hashSessionToken(token))) == 1
+}
+
+// ownsSession reports whether token is the one name was handed when they
+// entered the lobby
+func ownsSession(ctx context.Context, lobbyId string, name string, token string) (bool, error) {
+	storedHash, err := store.GetSessionTokenHash(ctx, lobbyId, name)
+	if err != nil {
+		return false, err
+	}
+
+	return sessionTokenMatches(storedHash, token), nil
+}
+
+func sessionTokenFrom(c *gin.Context) string {
+	if token := c.GetHeader(SESSION_TOKEN_HEADER); token != "" {
+		return token
+	}
+	return c.Query("sessionToken")
+}
+
+// isLobbyMember is always true for open lobbies. a password-protected one
+// only lets in admins and senders who entered it, going by their session
+// token. lobbies that don't exist pass too, so the handler can 404 as usual
+func isLobbyMember(ctx context.Context, c *gin.Context, lobbyId string, name string) (bool, error) {
+	if isAdmin(c) {
+		return true, nil
+	}
+
+	passwordHash, err := store.GetLobbyPasswordHash(ctx, lobbyId)
+	if errors.Is(err, errLobbyNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if passwordHash == nil {
+		return true, nil
+	}
+
+	return ownsSession(ctx, lobbyId, name, sessionTokenFrom(c))
+}
+
+// checkLobbyMember is isLobbyMember for handlers, writing the error response
+// itself when it returns false
+func checkLobbyMember(ctx context.Context, c *gin.Context, lobbyId string, name string) bool {
+	member, err := isLobbyMember(ctx, c, lobbyId, name)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return false
+	}
+
+	if !member {
+		c.JSON(http.StatusForbidden, gin.H{"code": ERR_NOT_A_MEMBER, "message": "This lobby is private, enter it first!"})
+		return false
+	}
+
+	return true
+}
+
+// requireMembership guards reads of a lobby, with ?name= saying who's asking
+func requireMembership() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := dbContext(c)
+		member, err := isLobbyMember(ctx, c, c.Param("id"), c.Query("name"))
+		cancel()
+
+		if err != nil {
+			respondDBError(c, err, http.StatusInternalServerError)
+			c.Abort()
+			return
+		}
+
+		if !member {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": ERR_NOT_A_MEMBER, "message": "This lobby is private, enter it first!"})
+			return
+		}
+
+		c.Next()
+	}
+}
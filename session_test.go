@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// privateLobbyReads are the routes requireMembership guards, with %s for the
+// lobby id
+var privateLobbyReads = []string{
+	"/lobby/%s",
+	"/lobby/%s/messages",
+	"/lobby/%s/count",
+	"/lobby/%s/senders",
+	"/lobby/%s/typing",
+	"/lobby/%s/export",
+	"/lobby/%s/stream",
+	"/ws/%s",
+	"/events/%s",
+}
+
+// createPrivateLobby makes a password-protected lobby with alice in it
+func createPrivateLobby(t *testing.T, router http.Handler) (string, string) {
+	t.Helper()
+
+	id := createTestLobby(t, router, createLobbyRequest{Password: "hunter2"})
+	w := doRequest(t, router, http.MethodPost, "/enterLobby", gin.H{"lobbyId": id, "name": "alice", "password": "hunter2"})
+	expectStatus(t, w, http.StatusOK)
+	return id, decodeBody[enterLobbyResponse](t, w).SessionToken
+}
+
+func TestPrivateLobbyRefusesNonMembers(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id, aliceToken := createPrivateLobby(t, router)
+
+	for _, route := range privateLobbyReads {
+		path := fmt.Sprintf(route, id)
+
+		for name, query := range map[string]string{
+			"no credentials":      "",
+			"a name but no token": "?name=alice",
+			"a made up token":     "?name=alice&sessionToken=nope",
+			"someone else's name": "?name=bob&sessionToken=" + aliceToken,
+			"a token but no name": "?sessionToken=" + aliceToken,
+		} {
+			w := doRequest(t, router, http.MethodGet, path+query, nil)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("GET %s with %s: got status %d, want 403", route, name, w.Code)
+			}
+		}
+	}
+}
+
+func TestPrivateLobbyLetsMembersRead(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id, aliceToken := createPrivateLobby(t, router)
+
+	// the rest stream until the client goes away
+	for _, route := range []string{"/lobby/%s", "/lobby/%s/messages", "/lobby/%s/count", "/lobby/%s/senders", "/lobby/%s/typing", "/lobby/%s/export"} {
+		req := newRequest(t, http.MethodGet, fmt.Sprintf(route, id)+"?name=alice", nil)
+		req.Header.Set(SESSION_TOKEN_HEADER, aliceToken)
+
+		if w := serve(router, req); w.Code != http.StatusOK {
+			t.Errorf("GET %s as alice: got status %d, want 200", route, w.Code)
+		}
+	}
+}
+
+func TestOpenLobbyNeedsNoSession(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+
+	w := doRequest(t, router, http.MethodGet, "/lobby/"+id, nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestPrivateLobbyPostNeedsSession(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id, aliceToken := createPrivateLobby(t, router)
+
+	post := gin.H{"lobbyId": id, "senderName": "alice", "messageContent": "hi"}
+
+	// never entered, or entered but can't prove it
+	w := doRequest(t, router, http.MethodPost, "/postMessage", gin.H{"lobbyId": id, "senderName": "mallory", "messageContent": "hi"})
+	expectStatus(t, w, http.StatusForbidden)
+	w = doRequest(t, router, http.MethodPost, "/postMessage", post)
+	expectStatus(t, w, http.StatusForbidden)
+
+	req := newRequest(t, http.MethodPost, "/postMessages", []gin.H{post})
+	expectStatus(t, serve(router, req), http.StatusForbidden)
+
+	req = newRequest(t, http.MethodPost, "/postMessage", post)
+	req.Header.Set(SESSION_TOKEN_HEADER, aliceToken)
+	expectStatus(t, serve(router, req), http.StatusCreated)
+}
+
+func TestPrivateLobbyWritesNeedSession(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id, aliceToken := createPrivateLobby(t, router)
+
+	req := newRequest(t, http.MethodPost, "/postMessage", gin.H{"lobbyId": id, "senderName": "alice", "messageContent": "hi"})
+	req.Header.Set(SESSION_TOKEN_HEADER, aliceToken)
+	w := serve(router, req)
+	expectStatus(t, w, http.StatusCreated)
+	msg := lastUserMessage(t, decodeBody[lobbyData](t, w))
+	messagePath := "/message/" + strconv.Itoa(msg.Id)
+
+	writes := []struct {
+		method string
+		path   string
+		body   gin.H
+	}{
+		{http.MethodGet, messagePath + "?name=alice", nil},
+		{http.MethodPost, messagePath + "/react", gin.H{"senderName": "alice", "emoji": "👍"}},
+		{http.MethodDelete, messagePath + "/react", gin.H{"senderName": "alice", "emoji": "👍"}},
+		{http.MethodPost, "/lobby/" + id + "/read", gin.H{"name": "alice", "lastReadMessageId": msg.Id}},
+		{http.MethodPut, "/lobby/" + id + "/name", gin.H{"senderName": "alice", "name": "renamed"}},
+		{http.MethodPost, "/leaveLobby", gin.H{"lobbyId": id, "name": "alice"}},
+	}
+
+	// alice's name without her token gets nowhere
+	for _, write := range writes {
+		w := doRequest(t, router, write.method, write.path, write.body)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s without a token: got status %d, want 403", write.method, write.path, w.Code)
+		}
+	}
+
+	for _, write := range writes {
+		req := newRequest(t, write.method, write.path, write.body)
+		req.Header.Set(SESSION_TOKEN_HEADER, aliceToken)
+
+		if w := serve(router, req); w.Code != http.StatusOK {
+			t.Errorf("%s %s as alice: got status %d, want 200", write.method, write.path, w.Code)
+		}
+	}
+}
+
+func TestRenameLobbyNeedsSender(t *testing.T) {
+	useMemStore(t)
+	router := newRouter()
+
+	id := createTestLobby(t, router, createLobbyRequest{})
+	enterTestLobby(t, router, id, "alice")
+
+	w := doRequest(t, router, http.MethodPut, "/lobby/"+id+"/name", gin.H{"senderName": "mallory", "name": "mine now"})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = doRequest(t, router, http.MethodPut, "/lobby/"+id+"/name", gin.H{"senderName": "alice", "name": "ours"})
+	expectStatus(t, w, http.StatusOK)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_SLOW_MODE_SECONDS = 3600
+
+// lobbySettings are the moderation knobs an admin can set per lobby. it's
+// embedded in lobbyData so the fields show up alongside the rest
+type lobbySettings struct {
+	SlowModeSeconds int  `json:"slowModeSeconds"`
+	ReadOnly        bool `json:"readOnly"`
+	SystemMessages  bool `json:"systemMessages"` // post "alice joined" and "alice left"
+	// set through /archive and /restore rather than PUT settings
+	Archived bool `json:"archived"`
+}
+
+func getLobbySettings(ctx context.Context, id string) (lobbySettings, error) {
+	var settings lobbySettings
+
+	row := db.QueryRowContext(ctx, "SELECT slowModeSeconds, readOnly, systemMessages, archived FROM lobbies WHERE id = ?", id)
+	if err := row.Scan(&settings.SlowModeSeconds, &settings.ReadOnly, &settings.SystemMessages, &settings.Archived); errors.Is(err, sql.ErrNoRows) {
+		return lobbySettings{}, errLobbyNotFound
+	} else if err != nil {
+		return lobbySettings{}, fmt.Errorf("get settings for %q: %w", id, err)
+	}
+
+	return settings, nil
+}
+
+func setLobbySettings(ctx context.Context, id string, settings lobbySettings) error {
+	_, err := db.ExecContext(ctx, "UPDATE lobbies SET slowModeSeconds = ?, readOnly = ?, systemMessages = ? WHERE id = ?", settings.SlowModeSeconds, settings.ReadOnly, settings.SystemMessages, id)
+	if err != nil {
+		return fmt.Errorf("set settings for %q: %w", id, err)
+	}
+	return nil
+}
+
+// slowModeWait is how much longer senderName has to wait before posting in
+// the lobby again, or 0 if they can post now
+func slowModeWait(ctx context.Context, lobbyId string, senderName string, slowModeSeconds int) (int64, error) {
+	last, err := store.LastPostTime(ctx, lobbyId, senderName)
+	if err != nil || last == 0 {
+		return 0, err
+	}
+
+	wait := last + int64(slowModeSeconds) - time.Now().Unix()
+	return max(wait, 0), nil
+}
+
+// updateLobbySettings only changes the fields present in the body
+func updateLobbySettings(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+
+	var request struct {
+		SlowModeSeconds *int  `json:"slowModeSeconds"`
+		ReadOnly        *bool `json:"readOnly"`
+		SystemMessages  *bool `json:"systemMessages"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_REQUEST, "message": "Could not parse request!"})
+		return
+	}
+
+	if request.SlowModeSeconds != nil && (*request.SlowModeSeconds < 0 || *request.SlowModeSeconds > MAX_SLOW_MODE_SECONDS) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": ERR_INVALID_PARAMETER, "message": "slowModeSeconds is out of range!", "max": MAX_SLOW_MODE_SECONDS})
+		return
+	}
+
+	lobbyMutex.Lock()
+	defer lobbyMutex.Unlock()
+
+	settings, err := store.GetLobbySettings(ctx, id)
+	if errors.Is(err, errLobbyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": ERR_LOBBY_NOT_FOUND, "message": "lobby not found"})
+		return
+	} else if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if request.SlowModeSeconds != nil {
+		settings.SlowModeSeconds = *request.SlowModeSeconds
+	}
+	if request.ReadOnly != nil {
+		settings.ReadOnly = *request.ReadOnly
+	}
+	if request.SystemMessages != nil {
+		settings.SystemMessages = *request.SystemMessages
+	}
+
+	if err := store.SetLobbySettings(ctx, id, settings); err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	result, err := store.GetLobby(ctx, id)
+	if err != nil {
+		respondDBError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondLobby(c, http.StatusOK, result)
+}
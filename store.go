@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var errMessageNotFound = errors.New("message not found")
+
+// Store is everything handlers and the reapers need from storage, so they
+// don't depend on MySQL directly. lobby lookups return errLobbyNotFound and
+// message lookups errMessageNotFound when there's nothing there.
+//
+// mysqlStore is the real one; memStore keeps everything in maps for tests.
+// the mutexes in main.go are still the caller's job, a Store doesn't lock
+// across calls
+type Store interface {
+	Ping(ctx context.Context) error
+
+	LobbyExists(ctx context.Context, id string) (bool, error)
+	// GetLobby returns the whole lobby, GetLobbyPage up to limit messages
+	// older than before (or the newest if before is 0)
+	GetLobby(ctx context.Context, id string) (lobbyData, error)
+	GetLobbyPage(ctx context.Context, id string, before int, limit int) (lobbyData, error)
+	// GetLobbyInfo is just the lobby's own fields, no messages or senders
+	GetLobbyInfo(ctx context.Context, id string) (lobbyData, error)
+	GetLobbySettings(ctx context.Context, id string) (lobbySettings, error)
+	SetLobbySettings(ctx context.Context, id string, settings lobbySettings) error
+	SetLobbyName(ctx context.Context, id string, name *string) error
+	// SetLobbyArchived reports false if there's no such lobby
+	SetLobbyArchived(ctx context.Context, id string, archived bool) (bool, error)
+	// GetLobbyPasswordHash returns nil for lobbies without a password
+	GetLobbyPasswordHash(ctx context.Context, id string) (*string, error)
+	AddLobby(ctx context.Context, id string, passwordHash *string, name *string, creatorIp string) error
+	CountLobbies(ctx context.Context) (int, error)
+	// CountLobbiesByIp only counts unarchived lobbies
+	CountLobbiesByIp(ctx context.Context, ip string) (int, error)
+	GetLobbySummaries(ctx context.Context) ([]lobbySummary, error)
+
+	// GetMessagesSince and GetMessage fill in reactions and attachments.
+	// msgType "" means every type
+	GetMessagesSince(ctx context.Context, lobbyId string, since int64, msgType string) ([]message, error)
+	GetMessage(ctx context.Context, id int) (message, error)
+	// EachMessage calls fn with every message in the lobby, oldest first,
+	// without reactions or attachments and without holding them all at once
+	EachMessage(ctx context.Context, lobbyId string, fn func(message) error) error
+	CountMessages(ctx context.Context, lobbyId string) (int, error)
+	// AddMessage stores an already validated message, working out its
+	// mentions, and returns it along with the lobby as of right after it.
+	// AddMessages does the same for several at once, all or nothing
+	AddMessage(ctx context.Context, msg message) (message, lobbyData, error)
+	AddMessages(ctx context.Context, lobbyId string, messages []message) ([]message, lobbyData, error)
+	// AddSystemMessage stores msg as is, with no mentions or sender to touch
+	AddSystemMessage(ctx context.Context, msg message) (message, error)
+	// UpdateMessageContent only applies if the message is still at version,
+	// and reports whether it did
+	UpdateMessageContent(ctx context.Context, id int, version int, content string, mentions mentionList) (bool, error)
+	// DeleteMessage soft-deletes: the message stays, marked deleted and
+	// unpinned, and its reactions go
+	DeleteMessage(ctx context.Context, id int) error
+	// ClearLobby deletes every message in the lobby and resets read positions
+	ClearLobby(ctx context.Context, lobbyId string) error
+	// ImportMessages adds messages and any senders not in the lobby yet. it
+	// applies capImportSenders against the senders already there, returning
+	// what was actually imported and the updated skips
+	ImportMessages(ctx context.Context, lobbyId string, messages []importedMessage, skipped []skippedImport) ([]importedMessage, []skippedImport, error)
+	// IsDuplicateMessage reports whether msg's sender posted the exact same
+	// content at or after since
+	IsDuplicateMessage(ctx context.Context, msg message, since int64) (bool, error)
+	// LastPostTime is when senderName last posted in the lobby, 0 if never
+	LastPostTime(ctx context.Context, lobbyId string, senderName string) (int64, error)
+	CountPins(ctx context.Context, lobbyId string) (int, error)
+	SetPinned(ctx context.Context, id int, pinned bool) error
+	// AddReaction reports false if the sender already reacted with that
+	// emoji, RemoveReaction if there was no such reaction
+	AddReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error)
+	RemoveReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error)
+
+	SenderExists(ctx context.Context, lobbyId string, name string) (bool, error)
+	GetSenders(ctx context.Context, lobbyId string) ([]sender, error)
+	// GetSenderPage returns up to limit senders by name, and whether there
+	// are more
+	GetSenderPage(ctx context.Context, lobbyId string, limit int, offset int) ([]sender, bool, error)
+	GetTypingNames(ctx context.Context, lobbyId string) ([]string, error)
+	CountSenders(ctx context.Context, lobbyId string) (int, error)
+	// InsertSender returns errUsernameTaken if the name is already in the
+	// lobby. it doesn't check capacity, see addSender
+	InsertSender(ctx context.Context, sndr sender, sessionTokenHash string) error
+	// SetSenderProfile updates whichever cosmetic fields are non-nil
+	SetSenderProfile(ctx context.Context, sndr sender) error
+	// RemoveSender reports whether there was anyone to remove
+	RemoveSender(ctx context.Context, lobbyId string, name string) (bool, error)
+	// RenameSender moves the sender's messages and reactions to the new
+	// name too. it returns errUsernameTaken or errSenderNotFound
+	RenameSender(ctx context.Context, lobbyId string, from string, to string) error
+	// TouchSender marks a sender as active right now
+	TouchSender(ctx context.Context, lobbyId string, name string) error
+	SetTyping(ctx context.Context, lobbyId string, name string, isTyping bool) error
+	// GetSessionTokenHash returns nil for senders that joined before tokens
+	// existed, or that aren't there
+	GetSessionTokenHash(ctx context.Context, lobbyId string, name string) (*string, error)
+	// SetLastRead only ever moves the position forward
+	SetLastRead(ctx context.Context, lobbyId string, name string, messageId int) error
+
+	// the reapers' deletes. LOBBY_LAST_ACTIVE says what counts as idle
+	ReapLobbiesIdleSince(ctx context.Context, cutoff int64) (int, error)
+	ArchiveLobbiesIdleSince(ctx context.Context, cutoff int64) (int64, error)
+	ReapSendersIdleSince(ctx context.Context, cutoff int64) (int64, error)
+	ReapMessagesOlderThan(ctx context.Context, cutoff int64) (int64, error)
+}
+
+var store Store = mysqlStore{}
+
+// mysqlStore is the Store backed by the global db. most methods just call
+// the query helpers that live next to the handlers using them
+type mysqlStore struct{}
+
+func (mysqlStore) Ping(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
+func (mysqlStore) LobbyExists(ctx context.Context, id string) (bool, error) {
+	return doesLobbyExist(ctx, db, id)
+}
+
+func (mysqlStore) GetLobby(ctx context.Context, id string) (lobbyData, error) {
+	return constructLobbyData(ctx, db, id)
+}
+
+func (mysqlStore) GetLobbyPage(ctx context.Context, id string, before int, limit int) (lobbyData, error) {
+	return constructLobbyPage(ctx, id, before, limit)
+}
+
+func (mysqlStore) GetLobbyInfo(ctx context.Context, id string) (lobbyData, error) {
+	return getLobby(ctx, db, id)
+}
+
+func (mysqlStore) GetLobbySettings(ctx context.Context, id string) (lobbySettings, error) {
+	return getLobbySettings(ctx, id)
+}
+
+func (mysqlStore) SetLobbySettings(ctx context.Context, id string, settings lobbySettings) error {
+	return setLobbySettings(ctx, id, settings)
+}
+
+func (mysqlStore) SetLobbyName(ctx context.Context, id string, name *string) error {
+	return setLobbyName(ctx, id, name)
+}
+
+func (mysqlStore) SetLobbyArchived(ctx context.Context, id string, archived bool) (bool, error) {
+	return setLobbyArchived(ctx, id, archived)
+}
+
+func (mysqlStore) GetLobbyPasswordHash(ctx context.Context, id string) (*string, error) {
+	return getLobbyPasswordHash(ctx, id)
+}
+
+func (mysqlStore) AddLobby(ctx context.Context, id string, passwordHash *string, name *string, creatorIp string) error {
+	return insertLobby(ctx, id, passwordHash, name, creatorIp)
+}
+
+func (mysqlStore) CountLobbies(ctx context.Context) (int, error) {
+	return countLobbies(ctx)
+}
+
+func (mysqlStore) CountLobbiesByIp(ctx context.Context, ip string) (int, error) {
+	return countLobbiesByIp(ctx, ip)
+}
+
+func (mysqlStore) GetLobbySummaries(ctx context.Context) ([]lobbySummary, error) {
+	return getLobbySummaries(ctx)
+}
+
+func (mysqlStore) GetMessagesSince(ctx context.Context, lobbyId string, since int64, msgType string) ([]message, error) {
+	messages, err := getMessagesSince(ctx, lobbyId, since, msgType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachReactions(ctx, db, lobbyId, messages); err != nil {
+		return nil, err
+	}
+
+	if err := loadAttachments(ctx, db, lobbyId, messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (mysqlStore) GetMessage(ctx context.Context, id int) (message, error) {
+	msg, err := getMessage(ctx, id)
+	if err != nil {
+		return message{}, err
+	}
+
+	single := []message{msg}
+	if err := attachReactions(ctx, db, msg.LobbyId, single); err != nil {
+		return message{}, err
+	}
+
+	if err := loadAttachments(ctx, db, msg.LobbyId, single); err != nil {
+		return message{}, err
+	}
+
+	return single[0], nil
+}
+
+func (mysqlStore) EachMessage(ctx context.Context, lobbyId string, fn func(message) error) error {
+	return eachMessage(ctx, lobbyId, fn)
+}
+
+func (mysqlStore) CountMessages(ctx context.Context, lobbyId string) (int, error) {
+	return countMessages(ctx, lobbyId)
+}
+
+func (mysqlStore) AddMessage(ctx context.Context, msg message) (message, lobbyData, error) {
+	inserted, lobby, err := mysqlStore{}.AddMessages(ctx, msg.LobbyId, []message{msg})
+	if err != nil {
+		return message{}, lobbyData{}, err
+	}
+
+	return inserted[0], lobby, nil
+}
+
+func (mysqlStore) AddMessages(ctx context.Context, lobbyId string, messages []message) ([]message, lobbyData, error) {
+	// read back inside the same transaction so the snapshot we return
+	// is guaranteed to include the messages we just wrote
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, lobbyData{}, err
+	}
+	defer tx.Rollback()
+
+	// only people actually in the lobby count as mentioned
+	senders, err := getSendersFor(ctx, tx, lobbyId)
+	if err != nil {
+		return nil, lobbyData{}, err
+	}
+
+	inserted := make([]message, 0, len(messages))
+	for _, msg := range messages {
+		msg.Mentions = parseMentions(msg.MessageString, senders)
+
+		added, err := appendMessage(ctx, tx, msg)
+		if err != nil {
+			return nil, lobbyData{}, err
+		}
+		inserted = append(inserted, added)
+
+		if err := touchSender(ctx, tx, lobbyId, msg.SenderName); err != nil {
+			return nil, lobbyData{}, err
+		}
+	}
+
+	lobby, err := constructLobbyData(ctx, tx, lobbyId)
+	if err != nil {
+		return nil, lobbyData{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, lobbyData{}, err
+	}
+
+	return inserted, lobby, nil
+}
+
+func (mysqlStore) AddSystemMessage(ctx context.Context, msg message) (message, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return message{}, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := appendMessage(ctx, tx, msg)
+	if err != nil {
+		return message{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return message{}, err
+	}
+
+	return inserted, nil
+}
+
+func (mysqlStore) UpdateMessageContent(ctx context.Context, id int, version int, content string, mentions mentionList) (bool, error) {
+	return updateMessageContent(ctx, id, version, content, mentions)
+}
+
+func (mysqlStore) DeleteMessage(ctx context.Context, id int) error {
+	return removeMessage(ctx, id)
+}
+
+func (mysqlStore) ClearLobby(ctx context.Context, lobbyId string) error {
+	return clearLobbyMessages(ctx, lobbyId)
+}
+
+func (mysqlStore) ImportMessages(ctx context.Context, lobbyId string, messages []importedMessage, skipped []skippedImport) ([]importedMessage, []skippedImport, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := getSendersFor(ctx, tx, lobbyId)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, skipped = capImportSenders(messages, skipped, existing)
+
+	if err := insertImport(ctx, tx, lobbyId, messages); err != nil {
+		return nil, nil, err
+	}
+
+	if maxMessagesPerLobby > 0 {
+		if err := trimMessages(ctx, tx, lobbyId, maxMessagesPerLobby); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return messages, skipped, nil
+}
+
+func (mysqlStore) IsDuplicateMessage(ctx context.Context, msg message, since int64) (bool, error) {
+	return isDuplicateMessage(ctx, msg, since)
+}
+
+func (mysqlStore) LastPostTime(ctx context.Context, lobbyId string, senderName string) (int64, error) {
+	var last sql.NullInt64
+
+	row := db.QueryRowContext(ctx, "SELECT MAX(timestamp) FROM message WHERE lobbyId = ? AND senderName = ?", lobbyId, senderName)
+	if err := row.Scan(&last); err != nil {
+		return 0, fmt.Errorf("get last post by %q in %q: %w", senderName, lobbyId, err)
+	}
+
+	return last.Int64, nil
+}
+
+func (mysqlStore) CountPins(ctx context.Context, lobbyId string) (int, error) {
+	return countPins(ctx, lobbyId)
+}
+
+func (mysqlStore) SetPinned(ctx context.Context, id int, pinned bool) error {
+	return setPinned(ctx, id, pinned)
+}
+
+func (mysqlStore) AddReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error) {
+	return addReaction(ctx, messageId, senderName, emoji)
+}
+
+func (mysqlStore) RemoveReaction(ctx context.Context, messageId int, senderName string, emoji string) (bool, error) {
+	return removeReaction(ctx, messageId, senderName, emoji)
+}
+
+func (mysqlStore) SenderExists(ctx context.Context, lobbyId string, name string) (bool, error) {
+	var val int
+
+	row := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sender WHERE lobbyId = ? AND name = ?", lobbyId, name)
+	if err := row.Scan(&val); err != nil {
+		return false, fmt.Errorf("check sender %q in %q: %w", name, lobbyId, err)
+	}
+
+	return val > 0, nil
+}
+
+func (mysqlStore) GetSenders(ctx context.Context, lobbyId string) ([]sender, error) {
+	return getSendersFor(ctx, db, lobbyId)
+}
+
+func (mysqlStore) GetSenderPage(ctx context.Context, lobbyId string, limit int, offset int) ([]sender, bool, error) {
+	return getSenderPage(ctx, lobbyId, limit, offset)
+}
+
+func (mysqlStore) GetTypingNames(ctx context.Context, lobbyId string) ([]string, error) {
+	return getTypingNames(ctx, lobbyId)
+}
+
+func (mysqlStore) CountSenders(ctx context.Context, lobbyId string) (int, error) {
+	return countSenders(ctx, lobbyId)
+}
+
+func (mysqlStore) InsertSender(ctx context.Context, sndr sender, sessionTokenHash string) error {
+	return insertSender(ctx, sndr, sessionTokenHash)
+}
+
+func (mysqlStore) SetSenderProfile(ctx context.Context, sndr sender) error {
+	return setSenderProfile(ctx, sndr)
+}
+
+func (mysqlStore) RemoveSender(ctx context.Context, lobbyId string, name string) (bool, error) {
+	return removeSender(ctx, lobbyId, name)
+}
+
+func (mysqlStore) RenameSender(ctx context.Context, lobbyId string, from string, to string) error {
+	return setSenderName(ctx, lobbyId, from, to)
+}
+
+func (mysqlStore) TouchSender(ctx context.Context, lobbyId string, name string) error {
+	return touchSender(ctx, db, lobbyId, name)
+}
+
+func (mysqlStore) SetTyping(ctx context.Context, lobbyId string, name string, isTyping bool) error {
+	return setTyping(ctx, lobbyId, name, isTyping)
+}
+
+func (mysqlStore) GetSessionTokenHash(ctx context.Context, lobbyId string, name string) (*string, error) {
+	return getSessionTokenHash(ctx, lobbyId, name)
+}
+
+func (mysqlStore) SetLastRead(ctx context.Context, lobbyId string, name string, messageId int) error {
+	return setLastRead(ctx, lobbyId, name, messageId)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"html"
+	"strings"
+)
+
+const MESSAGE_TYPE_USER = "user"
+const MESSAGE_TYPE_SYSTEM = "system"
+
+// messageTypeFilter maps ?type= to the type column, "" meaning every type.
+// clients say "text" for what's stored as "user"
+func messageTypeFilter(param string) (string, bool) {
+	switch param {
+	case "", "all":
+		return "", true
+	case "text":
+		return MESSAGE_TYPE_USER, true
+	case MESSAGE_TYPE_SYSTEM:
+		return MESSAGE_TYPE_SYSTEM, true
+	}
+	return "", false
+}
+
+// system messages are posted under this name, so it's always reserved
+const SYSTEM_SENDER_NAME = "system"
+
+// names nobody can join or post as, lowercased. RESERVED_USERNAMES adds to it
+var reservedNames = map[string]bool{SYSTEM_SENDER_NAME: true}
+
+func setupReservedNames() {
+	for _, name := range envList("RESERVED_USERNAMES") {
+		reservedNames[strings.ToLower(name)] = true
+	}
+}
+
+// isReservedName ignores case and surrounding whitespace, so "  Admin " is
+// as reserved as "admin"
+func isReservedName(name string) bool {
+	return reservedNames[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// postSystemMessage posts text as a system message if the lobby has
+// systemMessages turned on. a failure is only logged, it shouldn't stop
+// someone joining or leaving. callers should hold msgMutex
+func postSystemMessage(ctx context.Context, lobbyId string, text string) {
+	settings, err := store.GetLobbySettings(ctx, lobbyId)
+	if err != nil {
+		loggerFrom(ctx).Warn("posting system message", "lobbyId", lobbyId, "error", err)
+		return
+	}
+
+	if !settings.SystemMessages {
+		return
+	}
+
+	inserted, err := store.AddSystemMessage(ctx, message{LobbyId: lobbyId, SenderName: SYSTEM_SENDER_NAME, MessageString: text, Type: MESSAGE_TYPE_SYSTEM})
+	if err != nil {
+		dbErrors.Inc()
+		loggerFrom(ctx).Warn("posting system message", "lobbyId", lobbyId, "error", err)
+		return
+	}
+
+	messagesInserted.Inc()
+
+	inserted.MessageString = html.EscapeString(inserted.MessageString)
+	broadcast(lobbyId, inserted)
+}
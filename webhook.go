@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// how many messages can wait for delivery before new ones are dropped
+const WEBHOOK_QUEUE_SIZE = 256
+const WEBHOOK_TIMEOUT = 5 * time.Second
+const WEBHOOK_ATTEMPTS = 3
+const WEBHOOK_INITIAL_BACKOFF = time.Second
+
+// nil unless MESSAGE_WEBHOOK_URL is set
+var webhookQueue chan message
+
+func setupWebhook() {
+	url := os.Getenv("MESSAGE_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+
+	webhookQueue = make(chan message, WEBHOOK_QUEUE_SIZE)
+	go deliverWebhooks(url, webhookQueue)
+}
+
+// notifyWebhook queues msg for delivery without ever blocking the caller
+func notifyWebhook(msg message) {
+	if webhookQueue == nil {
+		return
+	}
+
+	select {
+	case webhookQueue <- msg:
+	default:
+		slog.Warn("webhook queue full, dropping message", "lobbyId", msg.LobbyId, "messageId", msg.Id)
+	}
+}
+
+// deliverWebhooks posts queued messages one at a time, so a slow endpoint
+// backs up the queue rather than piling up goroutines
+func deliverWebhooks(url string, queue <-chan message) {
+	client := &http.Client{Timeout: WEBHOOK_TIMEOUT}
+
+	for msg := range queue {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			slog.Error("encoding webhook", "messageId", msg.Id, "error", err)
+			continue
+		}
+
+		backoff := WEBHOOK_INITIAL_BACKOFF
+		for attempt := 1; ; attempt++ {
+			err = postWebhook(client, url, body)
+			if err == nil {
+				break
+			}
+
+			if attempt == WEBHOOK_ATTEMPTS {
+				slog.Error("webhook delivery failed, giving up", "messageId", msg.Id, "attempts", attempt, "error", err)
+				break
+			}
+
+			slog.Warn("webhook delivery failed, retrying", "messageId", msg.Id, "attempt", attempt, "error", err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func postWebhook(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}